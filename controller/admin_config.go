@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/poixeai/proxify/infra/response"
+	"github.com/poixeai/proxify/infra/watcher"
+)
+
+// AdminConfigVersionsHandler lists the kept config versions, newest first
+func AdminConfigVersionsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"data": watcher.Versions(),
+	})
+}
+
+// AdminConfigVersionHandler returns one version with its full config
+func AdminConfigVersionHandler(c *gin.Context) {
+	id, ok := versionParam(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	v, err := watcher.GetVersion(id)
+	if err != nil {
+		respondVersionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"version": v,
+			"config":  v.Config(),
+		},
+	})
+}
+
+// AdminConfigDiffHandler compares ?from= with ?to=, which defaults to the current version
+func AdminConfigDiffHandler(c *gin.Context) {
+	from, ok := versionParam(c, c.Query("from"))
+	if !ok {
+		return
+	}
+	to, ok := versionParam(c, c.DefaultQuery("to", "0"))
+	if !ok {
+		return
+	}
+
+	d, err := watcher.DiffVersions(from, to)
+	if err != nil {
+		respondVersionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": d,
+	})
+}
+
+// AdminConfigRollbackHandler serves an earlier version again
+func AdminConfigRollbackHandler(c *gin.Context) {
+	id, ok := versionParam(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	cfg, persisted, err := watcher.Rollback(id)
+	if err != nil {
+		respondVersionError(c, err)
+		return
+	}
+
+	current, _ := watcher.GetVersion(0)
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"version": current,
+			"routes":  len(cfg.Routes),
+		},
+		"persisted": persisted,
+	})
+}
+
+func versionParam(c *gin.Context, v string) (int, bool) {
+	id, err := strconv.Atoi(v)
+	if err != nil || id < 0 {
+		response.RespondError(c, http.StatusBadRequest, "Bad Request: version must be a version id.", response.INVALID_REQUEST_ERROR)
+		return 0, false
+	}
+	return id, true
+}
+
+func respondVersionError(c *gin.Context, err error) {
+	if errors.Is(err, watcher.ErrVersionNotFound) {
+		response.RespondError(c, http.StatusNotFound, "Not Found: "+err.Error()+".", response.NOT_FOUND_ERROR)
+		return
+	}
+	respondAdminError(c, err)
+}
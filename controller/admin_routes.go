@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/poixeai/proxify/infra/config"
+	"github.com/poixeai/proxify/infra/response"
+	"github.com/poixeai/proxify/infra/watcher"
+)
+
+// errRouteNotFound and errRouteExists map to 404 and 409
+var (
+	errRouteNotFound = errors.New("route not found")
+	errRouteExists   = errors.New("route already exists")
+)
+
+// AdminListRoutesHandler returns the routes in match order
+func AdminListRoutesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"data": watcher.GetRoutes().Routes,
+	})
+}
+
+// AdminGetRouteHandler returns one route, addressed by its path without the leading slash
+func AdminGetRouteHandler(c *gin.Context) {
+	r := watcher.GetRoutes().RouteByPath("/" + c.Param("name"))
+	if r == nil {
+		respondAdminError(c, errRouteNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data": r,
+	})
+}
+
+// AdminCreateRouteHandler adds a route, at the end or at ?position=
+func AdminCreateRouteHandler(c *gin.Context) {
+	var route config.Route
+	if err := bindRoute(c, &route); err != nil {
+		respondAdminError(c, err)
+		return
+	}
+
+	cfg, persisted, err := watcher.Update(func(cfg *config.RoutesConfig) error {
+		if cfg.RouteByPath(route.Path) != nil {
+			return errRouteExists
+		}
+		pos := len(cfg.Routes)
+		if v := c.Query("position"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 || n > len(cfg.Routes) {
+				return fmt.Errorf("%w: position must be between 0 and %d", watcher.ErrInvalidRoutes, len(cfg.Routes))
+			}
+			pos = n
+		}
+		cfg.Routes = append(cfg.Routes[:pos], append([]config.Route{route}, cfg.Routes[pos:]...)...)
+		return nil
+	})
+	if err != nil {
+		respondAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data":      cfg.RouteByPath(route.Path),
+		"persisted": persisted,
+	})
+}
+
+// AdminUpdateRouteHandler replaces a route, the body may rename its path
+func AdminUpdateRouteHandler(c *gin.Context) {
+	path := "/" + c.Param("name")
+
+	var route config.Route
+	if err := bindRoute(c, &route); err != nil {
+		respondAdminError(c, err)
+		return
+	}
+	if route.Path == "" {
+		route.Path = path
+	}
+
+	cfg, persisted, err := watcher.Update(func(cfg *config.RoutesConfig) error {
+		r := cfg.RouteByPath(path)
+		if r == nil {
+			return errRouteNotFound
+		}
+		if route.Path != path && cfg.RouteByPath(route.Path) != nil {
+			return errRouteExists
+		}
+		*r = route
+		return nil
+	})
+	if err != nil {
+		respondAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      cfg.RouteByPath(route.Path),
+		"persisted": persisted,
+	})
+}
+
+// AdminDeleteRouteHandler removes a route
+func AdminDeleteRouteHandler(c *gin.Context) {
+	path := "/" + c.Param("name")
+
+	_, persisted, err := watcher.Update(func(cfg *config.RoutesConfig) error {
+		for i := range cfg.Routes {
+			if cfg.Routes[i].Path == path {
+				cfg.Routes = append(cfg.Routes[:i], cfg.Routes[i+1:]...)
+				return nil
+			}
+		}
+		return errRouteNotFound
+	})
+	if err != nil {
+		respondAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      gin.H{"deleted": path},
+		"persisted": persisted,
+	})
+}
+
+type reorderRoutesRequest struct {
+	Paths []string `json:"paths"`
+}
+
+// AdminReorderRoutesHandler sets the route order, the body lists every route path once
+func AdminReorderRoutesHandler(c *gin.Context) {
+	var req reorderRoutesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.RespondBadRequestError(c)
+		return
+	}
+
+	cfg, persisted, err := watcher.Update(func(cfg *config.RoutesConfig) error {
+		if len(req.Paths) != len(cfg.Routes) {
+			return fmt.Errorf("%w: paths must list all %d routes", watcher.ErrInvalidRoutes, len(cfg.Routes))
+		}
+		routes := make([]config.Route, 0, len(cfg.Routes))
+		used := make(map[string]bool)
+		for _, p := range req.Paths {
+			r := cfg.RouteByPath(p)
+			if r == nil || used[p] {
+				return fmt.Errorf("%w: unknown or repeated path '%s'", watcher.ErrInvalidRoutes, p)
+			}
+			used[p] = true
+			routes = append(routes, *r)
+		}
+		cfg.Routes = routes
+		return nil
+	})
+	if err != nil {
+		respondAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      cfg.Routes,
+		"persisted": persisted,
+	})
+}
+
+func bindRoute(c *gin.Context, route *config.Route) error {
+	dec := json.NewDecoder(c.Request.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(route); err != nil {
+		return fmt.Errorf("%w: %v", watcher.ErrInvalidRoutes, err)
+	}
+	return nil
+}
+
+func respondAdminError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errRouteNotFound):
+		response.RespondError(c, http.StatusNotFound, "Not Found: "+err.Error()+".", response.NOT_FOUND_ERROR)
+	case errors.Is(err, errRouteExists):
+		response.RespondError(c, http.StatusConflict, "Conflict: "+err.Error()+".", response.INVALID_REQUEST_ERROR)
+	case errors.Is(err, watcher.ErrInvalidRoutes):
+		response.RespondError(c, http.StatusBadRequest, "Bad Request: "+err.Error(), response.INVALID_REQUEST_ERROR)
+	default:
+		response.RespondError(c, http.StatusInternalServerError, "Internal Server Error: "+err.Error(), response.INTERNAL_ERROR)
+	}
+}
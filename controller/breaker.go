@@ -0,0 +1,16 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/poixeai/proxify/infra/breaker"
+	"github.com/poixeai/proxify/infra/watcher"
+)
+
+// BreakersHandler returns the circuit breaker state of every route that has one
+func BreakersHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"data": breaker.Snapshot(watcher.GetRoutes()),
+	})
+}
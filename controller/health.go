@@ -0,0 +1,15 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/poixeai/proxify/infra/health"
+)
+
+// UpstreamHealthHandler returns the active health check state of every checked target
+func UpstreamHealthHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"data": health.Snapshot(),
+	})
+}
@@ -0,0 +1,15 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/poixeai/proxify/infra/metrics"
+)
+
+// MetricsHandler serves every gateway metric in Prometheus text format
+func MetricsHandler(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	metrics.WriteText(c.Writer)
+}
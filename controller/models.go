@@ -0,0 +1,18 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/poixeai/proxify/infra/catalog"
+	"github.com/poixeai/proxify/infra/watcher"
+)
+
+// ModelsHandler returns every model reachable through the gateway as an
+// OpenAI-format model list
+func ModelsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"data":   catalog.List(c.Request.Context(), watcher.GetRoutes()),
+	})
+}
@@ -1,19 +1,38 @@
 package controller
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/poixeai/proxify/infra/balancer"
+	"github.com/poixeai/proxify/infra/breaker"
+	"github.com/poixeai/proxify/infra/config"
+	"github.com/poixeai/proxify/infra/credential"
 	"github.com/poixeai/proxify/infra/ctx"
+	"github.com/poixeai/proxify/infra/health"
 	"github.com/poixeai/proxify/infra/logger"
+	"github.com/poixeai/proxify/infra/metrics"
+	"github.com/poixeai/proxify/infra/modelpolicy"
 	"github.com/poixeai/proxify/infra/response"
 	"github.com/poixeai/proxify/infra/stream"
+	"github.com/poixeai/proxify/infra/tracing"
+	"github.com/poixeai/proxify/infra/transport"
+	"github.com/poixeai/proxify/infra/usage"
 	"github.com/poixeai/proxify/util"
 )
 
+// largest body read only to find the model for tracing
+const maxModelPeek = 1 << 20
+
 var strippedProxyRequestHeaders = map[string]struct{}{
 	"true-client-ip":   {},
 	"x-real-ip":        {},
@@ -32,52 +51,270 @@ var xForwardedForStripSourceHeaders = []string{
 }
 
 func ProxyHandler(c *gin.Context) {
-	// build target URL
-	targetEndpoint := c.GetString(ctx.TargetEndpoint)
+	received := time.Now()
 	subPath := c.GetString(ctx.SubPath)
-	targetURL := util.JoinURL(targetEndpoint, subPath)
-	c.Set(ctx.TargetURL, targetURL)
+	targets := upstreamChain(c)
+	route := ctx.GetRoute(c)
 
-	// construct new request
-	ctx := c.Request.Context()
-	req, err := http.NewRequestWithContext(ctx, c.Request.Method, targetURL, c.Request.Body)
+	routeLabel := "-"
+	if route != nil {
+		routeLabel = route.Path
+	}
+
+	// fail fast instead of waiting on dead upstreams
+	if len(targets) == 0 {
+		logger.Warnf("No healthy target for route %s", route.Path)
+		response.RespondServiceUnavailableError(c, fmt.Sprintf(
+			"Service Unavailable: every upstream target of route [%s] is currently unavailable. Please try again later.",
+			route.Path,
+		))
+		return
+	}
+
+	// the model for tracing, when no middleware has parsed the body yet
+	if tracing.Enabled() && c.GetString(ctx.RequestModel) == "" &&
+		c.Request.ContentLength > 0 && c.Request.ContentLength <= maxModelPeek {
+		data, _ := util.PeekBody(c.Request)
+		c.Set(ctx.RequestModel, util.ModelOf(data))
+	}
+
+	// translate the request when the route speaks another protocol upstream
+	conv, subPath, body, err := translateRequest(c, route, subPath)
 	if err != nil {
-		logger.Errorf("Failed to create new request: %v", err)
-		response.RespondInternalError(c)
+		logger.Warnf("Failed to translate request for route %s: %v", route.Path, err)
+		response.RespondError(c, http.StatusBadRequest, "Bad Request: "+err.Error(), response.INVALID_REQUEST_ERROR)
 		return
 	}
+	if conv != nil {
+		// the upstream protocol may carry the model in the path, like gemini
+		if model := util.ModelOf(body); model != "" {
+			c.Set(ctx.RequestModel, model)
+		} else if model, _, _ := modelpolicy.PathModel(subPath); model != "" {
+			c.Set(ctx.RequestModel, model)
+		}
+	}
 
-	copyRequestHeaders(req.Header, c.Request.Header)
+	// buffer the body when failover is possible, so every attempt resends the same payload
+	if body == nil && len(targets) > 1 && c.Request.Body != nil {
+		body, err = io.ReadAll(c.Request.Body)
+		if err != nil {
+			logger.Errorf("Failed to read request body: %v", err)
+			response.RespondBadRequestError(c)
+			return
+		}
+	}
 
-	// create client
-	client := &http.Client{
-		Timeout: 0, // no timeout, let ctx control it
-		Transport: &http.Transport{
-			Proxy:               http.ProxyFromEnvironment,
-			DisableCompression:  true, // disable gzip, avoid stream cache
-			MaxIdleConnsPerHost: 50,
-		},
+	// circuit breaker, fail fast while the route is tripped
+	var permit *breaker.Permit
+	if route != nil {
+		if b := breaker.For(route); b != nil {
+			var ok bool
+			if permit, ok = b.Allow(); !ok {
+				logger.Warnf("Circuit breaker open for route %s, rejecting request", route.Path)
+				response.RespondServiceUnavailableError(c, fmt.Sprintf(
+					"Service Unavailable: the circuit breaker of route [%s] is open after repeated upstream failures. Please try again later.",
+					route.Path,
+				))
+				return
+			}
+		}
 	}
+	// gives a half-open probe back on every early return or panic, no-op after Done
+	defer permit.Cancel()
+	start := time.Now()
 
-	// do request
-	resp, err := client.Do(req)
-	if err != nil {
-		logger.Errorf("Failed to do request to target: %v", err)
-		response.RespondInternalError(c)
+	// shared client, keeps upstream connections alive across requests
+	client := transport.Client(route)
+
+	// route timeouts
+	var timeouts config.Timeouts
+	if route != nil && route.Timeouts != nil {
+		timeouts = *route.Timeouts
+	}
+
+	clientCtx := c.Request.Context()
+	reqCtx := clientCtx
+	if timeouts.Total > 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeoutCause(clientCtx, timeouts.Total.Std(), transport.ErrTotalTimeout)
+		defer cancel()
+	}
+
+	// try targets in order; nothing is written downstream until an attempt is accepted,
+	// so retrying never mixes two upstream responses
+	var resp *http.Response
+	var watchdog *transport.Watchdog
+	var upstreamSpan *tracing.Span
+	var lastErr error
+	for i, target := range targets {
+		last := i == len(targets)-1
+		targetEndpoint := target.URL
+
+		// build target URL
+		targetURL := util.JoinURL(targetEndpoint, subPath)
+		c.Set(ctx.TargetEndpoint, targetEndpoint)
+		c.Set(ctx.TargetURL, targetURL)
+
+		var reqBody io.Reader = c.Request.Body
+		if body != nil {
+			reqBody = bytes.NewReader(body)
+		}
+
+		// first-byte and idle timeouts of this attempt
+		wd, attemptCtx := transport.NewWatchdog(reqCtx, timeouts.FirstByte.Std(), timeouts.Idle.Std())
+
+		// client span of this attempt
+		attemptCtx, span := tracing.StartSpan(attemptCtx, c.Request.Method, tracing.KindClient)
+		span.SetAttr("http.request.method", c.Request.Method)
+		span.SetAttr("server.address", targetEndpoint)
+		span.SetAttr("url.path", subPath)
+		span.SetAttr("proxify.attempt", i+1)
+		span.SetAttr("proxify.request_id", c.GetString(ctx.RequestID))
+
+		// construct new request
+		req, err := http.NewRequestWithContext(attemptCtx, c.Request.Method, targetURL, reqBody)
+		if err != nil {
+			span.SetError(err.Error())
+			span.End()
+			wd.Stop()
+			logger.Errorf("Failed to create new request: %v", err)
+			response.RespondInternalError(c)
+			return
+		}
+
+		copyRequestHeaders(req.Header, c.Request.Header)
+		if conv != nil {
+			// the body is rewritten, compressed responses could not be converted back
+			req.Header.Del("Accept-Encoding")
+			req.Header.Set("Content-Type", "application/json")
+			conv.Headers(req.Header)
+		}
+
+		// replace the client's key with the upstream credential
+		if route != nil {
+			if cred := route.CredentialFor(target); cred != nil {
+				if err := credential.Apply(req, cred, gatewayTokenHeader(c)); err != nil {
+					span.SetError(err.Error())
+					span.End()
+					wd.Stop()
+					logger.Errorf("Failed to inject credential for route %s: %v", route.Path, err)
+					response.RespondInternalError(c)
+					return
+				}
+			}
+		}
+
+		// continue the trace upstream
+		tracing.Inject(attemptCtx, req.Header)
+
+		// do request
+		attemptStart := time.Now()
+		resp, err = client.Do(req)
+		metrics.UpstreamLatency.Observe(time.Since(attemptStart).Seconds(), routeLabel, attemptOutcome(resp, err))
+		if err != nil {
+			wd.Stop()
+			span.SetError(err.Error())
+			span.End()
+			if clientCtx.Err() != nil {
+				logger.Warnf("client disconnected before upstream %s responded", targetEndpoint)
+				return
+			}
+			lastErr = wd.Err(err)
+			resp = nil
+			logger.Errorf("Failed to do request to target %s: %v", targetEndpoint, lastErr)
+
+			// the total budget is spent, no point in trying the next target
+			if errors.Is(lastErr, transport.ErrTotalTimeout) {
+				break
+			}
+			if !last {
+				logger.Warnf("Failover: attempt %d/%d failed, trying next target", i+1, len(targets))
+			}
+			continue
+		}
+
+		span.SetAttr("http.response.status_code", resp.StatusCode)
+
+		if !last && route != nil && route.ShouldFailover(resp.StatusCode) {
+			span.SetError(fmt.Sprintf("failover on status %d", resp.StatusCode))
+			span.End()
+			logger.Warnf("Failover: target %s returned %d, attempt %d/%d, trying next target",
+				targetEndpoint, resp.StatusCode, i+1, len(targets))
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			wd.Stop()
+			resp = nil
+			continue
+		}
+
+		watchdog = wd
+		upstreamSpan = span
+		break
+	}
+
+	if resp == nil {
+		permit.Done(false, time.Since(start))
+		logger.Errorf("All %d upstream targets failed, last error: %v", len(targets), lastErr)
+		if transport.IsTimeout(lastErr) {
+			response.RespondGatewayTimeoutError(c)
+		} else {
+			response.RespondUpstreamError(c)
+		}
 		return
 	}
+	defer watchdog.Stop()
+	resp.Body = watchdog.Body(resp.Body, isStreamResponse(resp))
+	if conv != nil {
+		translateResponse(resp, conv)
+	}
+
+	// determine if response is a stream
+	streaming := isStreamResponse(resp)
+	c.Set(ctx.Streaming, streaming)
+
+	// end the client span once the body is done, after usage is known
+	if resp.StatusCode >= http.StatusInternalServerError {
+		upstreamSpan.SetError(http.StatusText(resp.StatusCode))
+	}
+	defer func() {
+		u, _ := c.Get(ctx.Usage)
+		up, _ := u.(*usage.Usage)
+		tracing.SetGenAI(upstreamSpan, c.GetString(ctx.RequestModel), up, streaming)
+		upstreamSpan.End()
+	}()
+
+	resp.Body = &firstByteReader{ReadCloser: resp.Body, observe: func() {
+		metrics.TimeToFirstByte.Observe(time.Since(received).Seconds(), routeLabel)
+	}}
 	defer resp.Body.Close()
+	permit.Done(resp.StatusCode < http.StatusInternalServerError, time.Since(start))
 
 	// copy response headers
 	for k, v := range resp.Header {
 		c.Writer.Header()[k] = v
 	}
 
-	// set status code
+	// set status code, from here on the response is committed to this upstream
 	c.Status(resp.StatusCode)
+	c.Writer.WriteHeaderNow()
+
+	// read token usage on the side while the body is copied
+	tap := usage.NewTap(resp, streaming)
+	resp.Body = tap
+	defer func() {
+		if u := tap.Usage(); u != nil {
+			c.Set(ctx.Usage, u)
+		}
+	}()
+
+	if streaming {
+		metrics.ActiveStreams.Inc(routeLabel)
+		streamStart := time.Now()
+		defer func() {
+			metrics.ActiveStreams.Dec(routeLabel)
+			metrics.StreamDuration.Observe(time.Since(streamStart).Seconds(), routeLabel)
+		}()
 
-	// determine if response is a stream
-	if isStreamResponse(resp) {
 		// stream copy with optional smoothing
 		if os.Getenv("STREAM_SMOOTHING_ENABLED") == "true" {
 			stream.Smoothing(c, resp)
@@ -85,10 +322,78 @@ func ProxyHandler(c *gin.Context) {
 			streamCopy(c, resp)
 		}
 	} else {
-		io.Copy(c.Writer, resp.Body)
+		if _, err := io.Copy(c.Writer, resp.Body); err != nil {
+			logger.Errorf("body copy error from %s: %v", c.GetString(ctx.TargetEndpoint), err)
+		}
 	}
 }
 
+// attemptOutcome labels an upstream attempt by status class, or error
+func attemptOutcome(resp *http.Response, err error) string {
+	if err != nil {
+		return "error"
+	}
+	return strconv.Itoa(resp.StatusCode/100) + "xx"
+}
+
+// firstByteReader calls observe once, when the first body byte arrives
+type firstByteReader struct {
+	io.ReadCloser
+	observe func()
+	seen    bool
+}
+
+func (r *firstByteReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 && !r.seen {
+		r.seen = true
+		r.observe()
+	}
+	return n, err
+}
+
+// upstreamChain returns the healthy targets to try for this request, in order
+func upstreamChain(c *gin.Context) []config.Target {
+	route := ctx.GetRoute(c)
+	if route == nil {
+		return []config.Target{{URL: c.GetString(ctx.TargetEndpoint)}}
+	}
+
+	var sel *balancer.Selection
+	if v, ok := c.Get(ctx.Upstream); ok {
+		sel, _ = v.(*balancer.Selection)
+	}
+
+	var chain []config.Target
+	if route.FailoverEnabled() {
+		chain = balancer.Chain(route, sel)
+	} else if sel != nil {
+		chain = []config.Target{sel.Target}
+	}
+
+	healthy := make([]config.Target, 0, len(chain))
+	for _, t := range chain {
+		if health.IsHealthy(route, t.URL) {
+			healthy = append(healthy, t)
+		}
+	}
+
+	if max := route.FailoverMaxAttempts(); len(healthy) > max {
+		healthy = healthy[:max]
+	}
+	return healthy
+}
+
+// gatewayTokenHeader returns the header clients authenticate with against the gateway
+func gatewayTokenHeader(c *gin.Context) string {
+	if v, ok := c.Get("auth_config"); ok {
+		if cfg, ok := v.(*config.AuthConfig); ok && cfg.TokenAuthEnabled() {
+			return cfg.TokenHeader
+		}
+	}
+	return ""
+}
+
 func copyRequestHeaders(dst, src http.Header) {
 	xForwardedForStripValues := collectXForwardedForStripValues(src)
 
@@ -187,6 +492,12 @@ func streamCopy(c *gin.Context, resp *http.Response) {
 					return
 				}
 				logger.Errorf("stream read error: %v", err)
+
+				// stalled upstream, tell the client instead of cutting the stream silently
+				if transport.IsTimeout(err) {
+					writer.Write(stream.TimeoutEvent(c.Request.URL.Path, err))
+					writer.Flush()
+				}
 				return
 			}
 		}
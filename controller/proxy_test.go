@@ -4,10 +4,18 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/poixeai/proxify/infra/balancer"
+	"github.com/poixeai/proxify/infra/breaker"
+	"github.com/poixeai/proxify/infra/config"
 	routectx "github.com/poixeai/proxify/infra/ctx"
+	"github.com/poixeai/proxify/infra/tracing"
+	"github.com/poixeai/proxify/infra/usage"
 )
 
 func TestProxyHandlerStripsClientIPsFromForwardingHeaders(t *testing.T) {
@@ -96,3 +104,435 @@ func TestCopyRequestHeadersRemovesClientIPDuplicatesFromForwardedChain(t *testin
 		t.Fatalf("expected X-Forwarded-For to remove known client IPs, got %q", got)
 	}
 }
+
+func TestProxyHandlerFailsOverAndReplaysBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var primaryBody, backupBody string
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		primaryBody = string(b)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		backupBody = string(b)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer backup.Close()
+
+	// closed server, connection refused
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	route := &config.Route{
+		Path: "/openai",
+		Targets: []config.Target{
+			{URL: dead.URL},
+			{URL: primary.URL},
+			{URL: backup.URL, Backup: true},
+		},
+	}
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/openai/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`))
+	c.Set(routectx.RouteConfig, route)
+	c.Set(routectx.Upstream, balancer.Pick(route, nil))
+	c.Set(routectx.SubPath, "/v1/chat/completions")
+
+	ProxyHandler(c)
+
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "ok" {
+		t.Fatalf("expected backup response, got %d %q", recorder.Code, recorder.Body.String())
+	}
+	if primaryBody != `{"model":"gpt-4o"}` || backupBody != primaryBody {
+		t.Fatalf("expected identical payload on every attempt, got %q and %q", primaryBody, backupBody)
+	}
+	if got := c.GetString(routectx.TargetEndpoint); got != backup.URL {
+		t.Fatalf("expected backup target to be recorded, got %q", got)
+	}
+}
+
+func TestProxyHandlerPassesThroughLastFailoverResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	attempts := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer upstream.Close()
+
+	route := &config.Route{
+		Path:     "/openai",
+		Targets:  []config.Target{{URL: upstream.URL}, {URL: upstream.URL + "/"}, {URL: upstream.URL + "//"}},
+		Failover: &config.Failover{MaxAttempts: 2},
+	}
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/openai/v1/chat/completions", strings.NewReader("{}"))
+	c.Set(routectx.RouteConfig, route)
+	c.Set(routectx.SubPath, "/v1/chat/completions")
+
+	ProxyHandler(c)
+
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected last upstream status to be passed through, got %d", recorder.Code)
+	}
+	if attempts != 2 {
+		t.Fatalf("expected max_attempts to cap retries at 2, got %d", attempts)
+	}
+}
+
+func TestProxyHandlerSendsErrorEventWhenStreamStalls(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: {\"choices\":[]}\n\n"))
+		w.(http.Flusher).Flush()
+		<-release // stall mid-stream
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	route := &config.Route{
+		Path:     "/openai",
+		Target:   upstream.URL,
+		Timeouts: &config.Timeouts{Idle: config.Duration(50 * time.Millisecond)},
+	}
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/openai/v1/chat/completions", strings.NewReader("{}"))
+	c.Set(routectx.RouteConfig, route)
+	c.Set(routectx.Upstream, balancer.Pick(route, nil))
+	c.Set(routectx.SubPath, "/v1/chat/completions")
+
+	done := make(chan struct{})
+	go func() {
+		ProxyHandler(c)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected idle timeout to end the stalled stream")
+	}
+
+	body := recorder.Body.String()
+	if !strings.HasPrefix(body, "data: {\"choices\":[]}\n\n") {
+		t.Fatalf("expected upstream chunk to be forwarded first, got %q", body)
+	}
+	if !strings.Contains(body, `"type":"timeout_error"`) {
+		t.Fatalf("expected an SSE timeout error event, got %q", body)
+	}
+}
+
+func TestProxyHandlerIdleTimeoutSparesSlowCompletion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// a non-stream completion sends nothing until generation is done
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(150 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer upstream.Close()
+
+	route := &config.Route{
+		Path:     "/openai",
+		Target:   upstream.URL,
+		Timeouts: &config.Timeouts{Idle: config.Duration(50 * time.Millisecond)},
+	}
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/openai/v1/chat/completions", strings.NewReader("{}"))
+	c.Set(routectx.RouteConfig, route)
+	c.Set(routectx.Upstream, balancer.Pick(route, nil))
+	c.Set(routectx.SubPath, "/v1/chat/completions")
+
+	ProxyHandler(c)
+
+	if recorder.Code != http.StatusOK || recorder.Body.String() != `{"choices":[]}` {
+		t.Fatalf("expected the slow completion to outlive the idle timeout, got %d %q", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestProxyHandlerFirstByteTimeoutFailsOver(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer fast.Close()
+
+	route := &config.Route{
+		Path:     "/openai",
+		Targets:  []config.Target{{URL: slow.URL}, {URL: fast.URL}},
+		Timeouts: &config.Timeouts{FirstByte: config.Duration(50 * time.Millisecond)},
+	}
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/openai/v1/models", http.NoBody)
+	c.Set(routectx.RouteConfig, route)
+	c.Set(routectx.SubPath, "/v1/models")
+
+	ProxyHandler(c)
+
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "ok" {
+		t.Fatalf("expected fast target to answer after first byte timeout, got %d %q", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestProxyHandlerInjectsUpstreamCredential(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("TEST_ANTHROPIC_KEY", "sk-ant-upstream")
+
+	var upstreamHeaders http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHeaders = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	route := &config.Route{
+		Path:       "/claude",
+		Target:     upstream.URL,
+		Credential: &config.Credential{Type: config.CredentialTypeAnthropic, Env: "TEST_ANTHROPIC_KEY"},
+	}
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/claude/v1/messages", strings.NewReader("{}"))
+	c.Request.Header.Set("Authorization", "Bearer client-key")
+	c.Request.Header.Set("x-api-key", "client-key")
+	c.Request.Header.Set("X-API-Token", "gateway-token-0123456789")
+	c.Request.Header.Set("anthropic-version", "2023-06-01")
+	c.Set("auth_config", &config.AuthConfig{TokenHeader: "X-API-Token", TokenKey: "gateway-token-0123456789"})
+	c.Set(routectx.RouteConfig, route)
+	c.Set(routectx.Upstream, balancer.Pick(route, nil))
+	c.Set(routectx.SubPath, "/v1/messages")
+
+	ProxyHandler(c)
+
+	if got := upstreamHeaders.Get("x-api-key"); got != "sk-ant-upstream" {
+		t.Fatalf("expected upstream credential in x-api-key, got %q", got)
+	}
+	for _, header := range []string{"Authorization", "X-API-Token"} {
+		if values := upstreamHeaders.Values(header); len(values) != 0 {
+			t.Fatalf("expected %s to be stripped, got %v", header, values)
+		}
+	}
+	if got := upstreamHeaders.Get("anthropic-version"); got != "2023-06-01" {
+		t.Fatalf("expected other headers to be preserved, got %q", got)
+	}
+}
+
+func TestProxyHandlerMissingCredentialReleasesProbe(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("TEST_MISSING_KEY", "")
+	os.Unsetenv("TEST_MISSING_KEY")
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected no upstream request without a credential")
+	}))
+	defer upstream.Close()
+
+	route := &config.Route{
+		Path:           "/missing-key",
+		Target:         upstream.URL,
+		Credential:     &config.Credential{Env: "TEST_MISSING_KEY"},
+		CircuitBreaker: &config.CircuitBreaker{MinRequests: 1, OpenDuration: config.Duration(time.Millisecond)},
+	}
+
+	// trip the breaker so the next requests are half-open probes
+	permit, _ := breaker.For(route).Allow()
+	permit.Done(false, 0)
+	time.Sleep(2 * time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest(http.MethodPost, "/missing-key/v1/chat/completions", strings.NewReader("{}"))
+		c.Set(routectx.RouteConfig, route)
+		c.Set(routectx.Upstream, balancer.Pick(route, nil))
+		c.Set(routectx.SubPath, "/v1/chat/completions")
+
+		ProxyHandler(c)
+
+		// a leaked probe would turn the second request into a 503
+		if recorder.Code != http.StatusInternalServerError {
+			t.Fatalf("request %d: expected 500 for a missing credential, got %d %s", i+1, recorder.Code, recorder.Body)
+		}
+	}
+	if state := breaker.For(route).State(); state != breaker.StateHalfOpen {
+		t.Fatalf("expected the breaker to stay half-open, got %s", state)
+	}
+}
+
+func TestProxyHandlerRecordsStreamUsage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, `data: {"model":"gpt-4o","choices":[{"delta":{"content":"hi"}}]}`+"\n\n")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, `data: {"model":"gpt-4o","choices":[],"usage":{"prompt_tokens":9,"completion_tokens":2,"total_tokens":11}}`+"\n\n")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+
+	route := &config.Route{Path: "/openai", Target: upstream.URL}
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/openai/v1/chat/completions", strings.NewReader("{}"))
+	c.Set(routectx.RouteConfig, route)
+	c.Set(routectx.Upstream, balancer.Pick(route, nil))
+	c.Set(routectx.SubPath, "/v1/chat/completions")
+
+	ProxyHandler(c)
+
+	if !strings.Contains(recorder.Body.String(), "[DONE]") {
+		t.Fatalf("expected stream to reach the client, got %q", recorder.Body.String())
+	}
+	v, _ := c.Get(routectx.Usage)
+	u, ok := v.(*usage.Usage)
+	if !ok || u.Model != "gpt-4o" || u.PromptTokens != 9 || u.CompletionTokens != 2 || u.TotalTokens != 11 {
+		t.Fatalf("expected stream usage on the context, got %+v", v)
+	}
+}
+
+func TestProxyHandlerPropagatesTraceparent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer collector.Close()
+	tracing.Init(tracing.Config{Endpoint: collector.URL})
+	defer tracing.Init(tracing.Config{})
+
+	var traceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	route := &config.Route{Path: "/openai", Target: upstream.URL}
+	incoming := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/openai/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`))
+	c.Request.Header.Set("traceparent", incoming)
+	c.Request = c.Request.WithContext(tracing.Extract(c.Request.Context(), c.Request.Header))
+	c.Set(routectx.RouteConfig, route)
+	c.Set(routectx.Upstream, balancer.Pick(route, nil))
+	c.Set(routectx.SubPath, "/v1/chat/completions")
+
+	ProxyHandler(c)
+
+	if !strings.HasPrefix(traceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-") || traceparent == incoming {
+		t.Fatalf("expected upstream traceparent in the same trace with a new span id, got %q", traceparent)
+	}
+	if got := c.GetString(routectx.RequestModel); got != "gpt-4o" {
+		t.Fatalf("expected the request model for the spans, got %q", got)
+	}
+}
+
+func TestProxyHandlerRecordsTranslatedRequestModel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"candidates":[]}`)
+	}))
+	defer upstream.Close()
+
+	route := &config.Route{Path: "/gemini", Target: upstream.URL, Protocol: config.ProtocolOpenAIToGemini}
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/gemini/v1/chat/completions",
+		strings.NewReader(`{"model":"gemini-2.0-flash","messages":[{"role":"user","content":"Hi"}]}`))
+	c.Set(routectx.RouteConfig, route)
+	c.Set(routectx.Upstream, balancer.Pick(route, nil))
+	c.Set(routectx.SubPath, "/v1/chat/completions")
+	c.Set(routectx.RequestModel, "client-alias")
+
+	ProxyHandler(c)
+
+	if got := c.GetString(routectx.RequestModel); got != "gemini-2.0-flash" {
+		t.Fatalf("expected the model from the translated upstream path, got %q", got)
+	}
+}
+
+func TestProxyHandlerTranslatesAnthropicToOpenAI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var upstreamPath, upstreamAuth string
+	var upstreamBody []byte
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamPath = r.URL.Path
+		upstreamAuth = r.Header.Get("Authorization")
+		upstreamBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, `data: {"id":"chatcmpl-1","model":"deepseek-chat","choices":[{"index":0,"delta":{"content":"Hello"},"finish_reason":null}]}`+"\n\n")
+		io.WriteString(w, `data: {"id":"chatcmpl-1","model":"deepseek-chat","choices":[{"index":0,"delta":{},"finish_reason":"stop"}],"usage":{"prompt_tokens":7,"completion_tokens":1,"total_tokens":8}}`+"\n\n")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+
+	route := &config.Route{Path: "/deepseek", Target: upstream.URL, Protocol: config.ProtocolAnthropicToOpenAI}
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/deepseek/v1/messages",
+		strings.NewReader(`{"model":"deepseek-chat","max_tokens":64,"stream":true,"messages":[{"role":"user","content":"Hi"}]}`))
+	c.Request.Header.Set("x-api-key", "sk-client")
+	c.Request.Header.Set("anthropic-version", "2023-06-01")
+	c.Set(routectx.RouteConfig, route)
+	c.Set(routectx.Upstream, balancer.Pick(route, nil))
+	c.Set(routectx.SubPath, "/v1/messages")
+
+	ProxyHandler(c)
+
+	if upstreamPath != "/v1/chat/completions" || upstreamAuth != "Bearer sk-client" {
+		t.Fatalf("expected chat completions call with bearer key, got %s %q", upstreamPath, upstreamAuth)
+	}
+	if !strings.Contains(string(upstreamBody), `"messages":[{"role":"user","content":"Hi"}]`) {
+		t.Fatalf("unexpected upstream body %s", upstreamBody)
+	}
+
+	out := recorder.Body.String()
+	for _, want := range []string{"event: message_start", `"text":"Hello"`, `"stop_reason":"end_turn"`, "event: message_stop"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected client stream to contain %s, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "[DONE]") {
+		t.Fatal("expected openai done marker to be translated away")
+	}
+
+	v, _ := c.Get(routectx.Usage)
+	if u, ok := v.(*usage.Usage); !ok || u.PromptTokens != 7 || u.CompletionTokens != 1 {
+		t.Fatalf("expected usage from the translated stream, got %+v", v)
+	}
+}
@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/poixeai/proxify/infra/logger"
+	"github.com/poixeai/proxify/infra/quota"
+	"github.com/poixeai/proxify/infra/response"
+	"github.com/poixeai/proxify/infra/watcher"
+)
+
+// QuotaHandler returns the token budget of every client on routes with a quota,
+// optionally filtered by ?route= and ?identity=
+func QuotaHandler(c *gin.Context) {
+	route, identity := c.Query("route"), c.Query("identity")
+
+	list := make([]quota.Status, 0)
+	for _, st := range quota.Snapshot(watcher.GetRoutes(), time.Now()) {
+		if (route == "" || st.Route == route) && (identity == "" || st.Identity == identity) {
+			list = append(list, st)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": list,
+	})
+}
+
+type quotaResetRequest struct {
+	Route    string `json:"route"`
+	Identity string `json:"identity"`
+}
+
+// QuotaResetHandler clears the counters matching route and identity,
+// an empty field matches everything
+func QuotaResetHandler(c *gin.Context) {
+	var req quotaResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.RespondBadRequestError(c)
+		return
+	}
+
+	n := quota.Reset(req.Route, req.Identity)
+	logger.Infof("[Quota] reset route=%q identity=%q, counters=%d", req.Route, req.Identity, n)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{"reset": n},
+	})
+}
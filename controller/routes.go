@@ -5,11 +5,34 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/poixeai/proxify/infra/watcher"
+	"github.com/poixeai/proxify/util"
 )
 
+// publicRoute is what the unauthenticated route list shows of a route,
+// targets may carry expanded secrets in their user info or query
+type publicRoute struct {
+	Path        string `json:"path"`
+	Target      string `json:"target"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
 func RoutesHandler(c *gin.Context) {
 	cfg := watcher.GetRoutes()
+	routes := make([]publicRoute, 0, len(cfg.Routes))
+	for i := range cfg.Routes {
+		r := &cfg.Routes[i]
+		pr := publicRoute{
+			Path:        r.Path,
+			Name:        r.Name,
+			Description: r.Description,
+		}
+		if ups := r.Upstreams(); len(ups) > 0 {
+			pr.Target = util.RedactURL(ups[0].URL)
+		}
+		routes = append(routes, pr)
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"data": cfg.Routes,
+		"data": routes,
 	})
 }
@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/poixeai/proxify/infra/config"
+	"github.com/poixeai/proxify/infra/logger"
+	"github.com/poixeai/proxify/infra/translate"
+)
+
+// translateRequest rewrites the client request when the route speaks another
+// protocol upstream. It returns a nil converter for plain proxying.
+func translateRequest(c *gin.Context, route *config.Route, subPath string) (translate.Converter, string, []byte, error) {
+	if route == nil || route.Protocol == "" || c.Request.Body == nil {
+		return nil, subPath, nil, nil
+	}
+	protocol := translate.For(route.Protocol)
+	if protocol == nil {
+		return nil, subPath, nil, nil
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, subPath, nil, err
+	}
+
+	req, conv, err := protocol(subPath, body)
+	if err != nil {
+		return nil, subPath, nil, err
+	}
+	if req == nil {
+		// not a translated endpoint, proxy the original body
+		return nil, subPath, body, nil
+	}
+
+	logger.Debugf("Translate: route=%s protocol=%s %s -> %s", route.Path, route.Protocol, subPath, req.Path)
+	return conv, req.Path, req.Body, nil
+}
+
+// translateResponse converts the upstream response back into the client's
+// protocol, streams are converted event by event while they are read
+func translateResponse(resp *http.Response, conv translate.Converter) {
+	resp.Header.Del("Content-Length")
+
+	if resp.StatusCode < http.StatusBadRequest && isStreamResponse(resp) {
+		resp.Body = translate.NewStreamReader(resp.Body, conv)
+		resp.Header.Set("Content-Type", "text/event-stream")
+		return
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		// keep what arrived, the copy below reports the failure
+		logger.Errorf("Translate: failed to read upstream response: %v", err)
+	}
+
+	out := body
+	if resp.StatusCode >= http.StatusBadRequest {
+		out = conv.Error(resp.StatusCode, body)
+	} else if converted, err := conv.Response(body); err != nil {
+		logger.Errorf("Translate: failed to convert upstream response: %v", err)
+	} else {
+		out = converted
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(out))
+	resp.Header.Set("Content-Type", "application/json")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(out)))
+}
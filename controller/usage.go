@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/poixeai/proxify/infra/billing"
+	"github.com/poixeai/proxify/infra/response"
+)
+
+// UsageHandler returns aggregated token usage and spend between ?from= and
+// ?to= (RFC 3339 or 2006-01-02, default the last 24 hours), grouped by the
+// comma separated ?group_by= (identity, owner, route, model, day, hour)
+func UsageHandler(c *gin.Context) {
+	now := time.Now()
+
+	to, err := parseUsageTime(c.Query("to"), now)
+	if err != nil {
+		response.RespondError(c, http.StatusBadRequest, "Bad Request: invalid 'to', use RFC 3339 or YYYY-MM-DD.", response.INVALID_REQUEST_ERROR)
+		return
+	}
+	from, err := parseUsageTime(c.Query("from"), to.Add(-24*time.Hour))
+	if err != nil {
+		response.RespondError(c, http.StatusBadRequest, "Bad Request: invalid 'from', use RFC 3339 or YYYY-MM-DD.", response.INVALID_REQUEST_ERROR)
+		return
+	}
+
+	groupBy := []string{billing.GroupRoute, billing.GroupModel}
+	if raw := strings.TrimSpace(c.Query("group_by")); raw != "" {
+		groupBy = nil
+		for _, g := range strings.Split(raw, ",") {
+			if g = strings.TrimSpace(g); g != "" {
+				groupBy = append(groupBy, g)
+			}
+		}
+	}
+
+	rows, err := billing.Query(from, to, groupBy)
+	if err != nil {
+		response.RespondError(c, http.StatusBadRequest, "Bad Request: "+err.Error()+".", response.INVALID_REQUEST_ERROR)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"from":     from.UTC().Format(time.RFC3339),
+			"to":       to.UTC().Format(time.RFC3339),
+			"group_by": groupBy,
+			"rows":     rows,
+		},
+	})
+}
+
+func parseUsageTime(raw string, def time.Time) (time.Time, error) {
+	if raw == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", raw)
+}
@@ -0,0 +1,231 @@
+package balancer
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/poixeai/proxify/infra/config"
+)
+
+type targetState struct {
+	target   config.Target
+	index    int // index in route.Upstreams()
+	weight   int
+	current  int          // smooth weighted round robin state, guarded by Balancer.mu
+	inflight atomic.Int64 // outstanding requests
+}
+
+// Balancer picks one target of a route per request
+type Balancer struct {
+	mu       sync.Mutex
+	strategy string
+	targets  []*targetState
+}
+
+// Selection is the target chosen for a single request
+type Selection struct {
+	Target config.Target
+	Index  int // index in route.Upstreams()
+
+	state *targetState
+	once  sync.Once
+}
+
+// Done releases the outstanding request counted for the selected target
+func (s *Selection) Done() {
+	if s == nil || s.state == nil {
+		return
+	}
+	s.once.Do(func() {
+		s.state.inflight.Add(-1)
+	})
+}
+
+func New(strategy string, targets []config.Target) *Balancer {
+	if strategy == "" {
+		strategy = config.LoadBalanceWeightedRoundRobin
+	}
+
+	// backup targets only take traffic through failover,
+	// unless nothing else is configured
+	balanced := 0
+	for _, t := range targets {
+		if !t.Backup {
+			balanced++
+		}
+	}
+
+	b := &Balancer{strategy: strategy}
+	for i, t := range targets {
+		if t.Backup && balanced > 0 {
+			continue
+		}
+		b.targets = append(b.targets, &targetState{
+			target: t,
+			index:  i,
+			weight: t.EffectiveWeight(),
+		})
+	}
+	return b
+}
+
+// Pick chooses a target and counts it as outstanding until Selection.Done is called.
+// Targets rejected by available (when not nil) are skipped.
+// Returns nil when no target can be picked.
+func (b *Balancer) Pick(available func(config.Target) bool) *Selection {
+	candidates := make([]int, 0, len(b.targets))
+	for i, st := range b.targets {
+		if available == nil || available(st.target) {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	var idx int
+	switch b.strategy {
+	case config.LoadBalanceLeastRequests:
+		idx = b.pickLeastRequests(candidates)
+	case config.LoadBalanceRandom:
+		idx = b.pickRandom(candidates)
+	default:
+		idx = b.pickWeightedRoundRobin(candidates)
+	}
+
+	st := b.targets[idx]
+	st.inflight.Add(1)
+
+	return &Selection{
+		Target: st.target,
+		Index:  st.index,
+		state:  st,
+	}
+}
+
+// smooth weighted round robin (same algorithm as nginx)
+func (b *Balancer) pickWeightedRoundRobin(candidates []int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	total := 0
+	best := -1
+	for _, i := range candidates {
+		st := b.targets[i]
+		st.current += st.weight
+		total += st.weight
+		if best == -1 || st.current > b.targets[best].current {
+			best = i
+		}
+	}
+	b.targets[best].current -= total
+	return best
+}
+
+// lowest outstanding requests relative to weight, ties resolved by declaration order
+func (b *Balancer) pickLeastRequests(candidates []int) int {
+	best := -1
+	var bestLoad float64
+	for _, i := range candidates {
+		st := b.targets[i]
+		load := float64(st.inflight.Load()) / float64(st.weight)
+		if best == -1 || load < bestLoad {
+			best = i
+			bestLoad = load
+		}
+	}
+	return best
+}
+
+// weighted random
+func (b *Balancer) pickRandom(candidates []int) int {
+	total := 0
+	for _, i := range candidates {
+		total += b.targets[i].weight
+	}
+
+	n := rand.Intn(total)
+	for _, i := range candidates {
+		if n < b.targets[i].weight {
+			return i
+		}
+		n -= b.targets[i].weight
+	}
+	return candidates[len(candidates)-1]
+}
+
+// Chain returns the ordered fallback chain of a route for one request: the
+// selected target first, then the other balanced targets and finally the
+// backup targets, both in declaration order
+func Chain(route *config.Route, sel *Selection) []config.Target {
+	upstreams := route.Upstreams()
+	if sel == nil || sel.Index < 0 || sel.Index >= len(upstreams) {
+		return upstreams
+	}
+
+	chain := make([]config.Target, 0, len(upstreams))
+	chain = append(chain, upstreams[sel.Index])
+	for i, t := range upstreams {
+		if i != sel.Index && !t.Backup {
+			chain = append(chain, t)
+		}
+	}
+	for i, t := range upstreams {
+		if i != sel.Index && t.Backup {
+			chain = append(chain, t)
+		}
+	}
+	return chain
+}
+
+/* --------------------- Registry ---------------------- */
+
+type entry struct {
+	signature string
+	balancer  *Balancer
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]*entry) // route path -> balancer
+)
+
+// For returns the balancer of a route, it is rebuilt when the route's targets
+// or strategy change after a hot reload
+func For(route *config.Route) *Balancer {
+	sig := signature(route)
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if e, ok := registry[route.Path]; ok && e.signature == sig {
+		return e.balancer
+	}
+
+	b := New(route.LoadBalance, route.Upstreams())
+	registry[route.Path] = &entry{signature: sig, balancer: b}
+	return b
+}
+
+// Pick is a shortcut for For(route).Pick(available)
+func Pick(route *config.Route, available func(config.Target) bool) *Selection {
+	return For(route).Pick(available)
+}
+
+func signature(route *config.Route) string {
+	var sb strings.Builder
+	sb.WriteString(route.LoadBalance)
+	for _, t := range route.Upstreams() {
+		sb.WriteString("|")
+		sb.WriteString(t.URL)
+		sb.WriteString("#")
+		sb.WriteString(strconv.Itoa(t.EffectiveWeight()))
+		if t.Backup {
+			sb.WriteString("#backup")
+		}
+	}
+	return sb.String()
+}
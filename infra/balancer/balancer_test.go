@@ -0,0 +1,80 @@
+package balancer
+
+import (
+	"testing"
+
+	"github.com/poixeai/proxify/infra/config"
+)
+
+func TestWeightedRoundRobinFollowsWeights(t *testing.T) {
+	b := New(config.LoadBalanceWeightedRoundRobin, []config.Target{
+		{URL: "https://a.example.com", Weight: 3},
+		{URL: "https://b.example.com", Weight: 1},
+	})
+
+	counts := map[string]int{}
+	for i := 0; i < 8; i++ {
+		sel := b.Pick(nil)
+		counts[sel.Target.URL]++
+		sel.Done()
+	}
+
+	if counts["https://a.example.com"] != 6 || counts["https://b.example.com"] != 2 {
+		t.Fatalf("expected 6/2 split, got %v", counts)
+	}
+}
+
+func TestLeastRequestsPrefersIdleTarget(t *testing.T) {
+	b := New(config.LoadBalanceLeastRequests, []config.Target{
+		{URL: "https://a.example.com"},
+		{URL: "https://b.example.com"},
+	})
+
+	first := b.Pick(nil)
+	second := b.Pick(nil)
+	if first.Target.URL == second.Target.URL {
+		t.Fatalf("expected outstanding request to move next pick to the other target, got %q twice", first.Target.URL)
+	}
+
+	first.Done()
+	first.Done() // must be idempotent
+
+	third := b.Pick(nil)
+	if third.Target.URL != first.Target.URL {
+		t.Fatalf("expected released target %q to be picked, got %q", first.Target.URL, third.Target.URL)
+	}
+}
+
+func TestForRebuildsOnTargetChange(t *testing.T) {
+	route := &config.Route{Path: "/rebuild", Target: "https://a.example.com"}
+	b1 := For(route)
+	if For(route) != b1 {
+		t.Fatal("expected balancer to be reused for unchanged route")
+	}
+
+	route.Targets = []config.Target{{URL: "https://b.example.com"}}
+	if For(route) == b1 {
+		t.Fatal("expected balancer to be rebuilt after targets changed")
+	}
+	if got := Pick(route, nil).Target.URL; got != "https://b.example.com" {
+		t.Fatalf("expected new target, got %q", got)
+	}
+}
+
+func TestPickSkipsUnavailableTargets(t *testing.T) {
+	b := New(config.LoadBalanceRandom, []config.Target{
+		{URL: "https://a.example.com"},
+		{URL: "https://b.example.com"},
+	})
+
+	onlyB := func(target config.Target) bool { return target.URL == "https://b.example.com" }
+	for i := 0; i < 10; i++ {
+		if got := b.Pick(onlyB).Target.URL; got != "https://b.example.com" {
+			t.Fatalf("expected only available target to be picked, got %q", got)
+		}
+	}
+
+	if sel := b.Pick(func(config.Target) bool { return false }); sel != nil {
+		t.Fatalf("expected no selection when every target is unavailable, got %q", sel.Target.URL)
+	}
+}
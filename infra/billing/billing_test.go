@@ -0,0 +1,79 @@
+package billing
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/poixeai/proxify/infra/config"
+	"github.com/poixeai/proxify/infra/usage"
+)
+
+func TestPriceForPrefersRouteAndExactMatches(t *testing.T) {
+	cfg := &config.RoutesConfig{Prices: map[string]config.Price{
+		"gpt-4o*":      {Input: 2.5, Output: 10},
+		"gpt-4o-mini*": {Input: 0.15, Output: 0.6},
+	}}
+	route := &config.Route{Path: "/azure", Prices: map[string]config.Price{
+		"gpt-4o": {Input: 3, Output: 12},
+	}}
+
+	cases := map[string]float64{
+		"gpt-4o-2024-08-06":      2.5,
+		"gpt-4o-mini-2024-07-18": 0.15,
+	}
+	for model, want := range cases {
+		if p, ok := PriceFor(cfg, nil, model); !ok || p.Input != want {
+			t.Errorf("%s: expected input price %v, got %+v (found=%v)", model, want, p, ok)
+		}
+	}
+
+	if p, _ := PriceFor(cfg, route, "gpt-4o"); p.Input != 3 {
+		t.Fatalf("expected route price to override the table, got %+v", p)
+	}
+	if _, ok := PriceFor(cfg, route, "claude-sonnet-4"); ok {
+		t.Fatal("expected unknown model to have no price")
+	}
+}
+
+func TestCostUsesCachedPrice(t *testing.T) {
+	p := config.Price{Input: 3, Output: 15, CachedInput: 0.3}
+	u := &usage.Usage{PromptTokens: 1_000_000, CachedTokens: 400_000, CompletionTokens: 100_000}
+
+	// 600k * 3 + 400k * 0.3 + 100k * 15 = 1.8 + 0.12 + 1.5
+	if got := Cost(p, u); math.Abs(got-3.42) > 1e-9 {
+		t.Fatalf("expected cost 3.42, got %v", got)
+	}
+}
+
+func TestQueryGroupsBuckets(t *testing.T) {
+	defer func() {
+		mu.Lock()
+		buckets = make(map[string]*Bucket)
+		mu.Unlock()
+	}()
+
+	day := time.Date(2026, 5, 1, 10, 30, 0, 0, time.UTC)
+	Record(Entry{Time: day, Identity: "key:a", Owner: "team-a", Route: "/openai", Usage: &usage.Usage{Model: "gpt-4o", TotalTokens: 10}, Cost: 1, Priced: true})
+	Record(Entry{Time: day.Add(time.Hour), Identity: "key:a", Owner: "team-a", Route: "/openai", Usage: &usage.Usage{Model: "gpt-4o-mini", TotalTokens: 20}, Cost: 0.5, Priced: true})
+	Record(Entry{Time: day, Identity: "key:b", Owner: "team-b", Route: "/claude", Usage: &usage.Usage{Model: "claude-sonnet-4", TotalTokens: 5}})
+	Record(Entry{Time: day.Add(48 * time.Hour), Identity: "key:a", Owner: "team-a", Route: "/openai", Usage: &usage.Usage{Model: "gpt-4o", TotalTokens: 99}, Cost: 9, Priced: true})
+
+	rows, err := Query(day.Add(-time.Hour), day.Add(24*time.Hour), []string{GroupOwner})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected two owners, got %+v", rows)
+	}
+	if rows[0].Owner != "team-a" || rows[0].Requests != 2 || rows[0].TotalTokens != 30 || rows[0].Cost != 1.5 {
+		t.Fatalf("unexpected top row %+v", rows[0])
+	}
+	if rows[1].Owner != "team-b" || rows[1].UnpricedRequests != 1 {
+		t.Fatalf("expected unpriced request to be counted, got %+v", rows[1])
+	}
+
+	if _, err := Query(day, day, []string{"team"}); err == nil {
+		t.Fatal("expected unknown group_by to be rejected")
+	}
+}
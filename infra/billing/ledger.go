@@ -0,0 +1,271 @@
+package billing
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/poixeai/proxify/infra/logger"
+	"github.com/poixeai/proxify/infra/store"
+	"github.com/poixeai/proxify/infra/usage"
+)
+
+const (
+	StorePathEnv     = "USAGE_STORE_PATH"
+	DefaultStorePath = "data/usage.json"
+
+	// how often dirty buckets are written to disk
+	flushInterval = 10 * time.Second
+	// buckets older than this are dropped
+	retention = 400 * 24 * time.Hour
+)
+
+// Group-by dimensions accepted by Query
+const (
+	GroupIdentity = "identity"
+	GroupOwner    = "owner"
+	GroupRoute    = "route"
+	GroupModel    = "model"
+	GroupDay      = "day"
+	GroupHour     = "hour"
+)
+
+// Entry is the accounting of one request
+type Entry struct {
+	Time     time.Time
+	Identity string
+	Owner    string
+	Route    string
+	Usage    *usage.Usage
+	Cost     float64
+	Priced   bool // false when no price matched the model
+}
+
+// Bucket aggregates the spend of one identity, route and model in one hour
+type Bucket struct {
+	Hour     time.Time `json:"hour"`
+	Identity string    `json:"identity"`
+	Owner    string    `json:"owner,omitempty"`
+	Route    string    `json:"route"`
+	Model    string    `json:"model"`
+	Totals
+}
+
+// Totals are the summed counters of a bucket or query row
+type Totals struct {
+	Requests         int64   `json:"requests"`
+	UnpricedRequests int64   `json:"unpriced_requests,omitempty"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	CachedTokens     int64   `json:"cached_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// Row is one group of a Query result, only the grouped fields are set
+type Row struct {
+	Identity string `json:"identity,omitempty"`
+	Owner    string `json:"owner,omitempty"`
+	Route    string `json:"route,omitempty"`
+	Model    string `json:"model,omitempty"`
+	Day      string `json:"day,omitempty"`
+	Hour     string `json:"hour,omitempty"`
+	Totals
+}
+
+type file struct {
+	Buckets []*Bucket `json:"buckets"`
+}
+
+var (
+	mu      sync.Mutex
+	buckets = make(map[string]*Bucket)
+	dirty   bool
+	path    string // empty keeps buckets in memory only
+
+	// serializes flushes from the snapshot to the rename, so an older
+	// snapshot never replaces a newer one on disk
+	flushMu sync.Mutex
+
+	openOnce sync.Once
+)
+
+// Open loads the persisted buckets from path and keeps writing them back
+// in the background. Without Open, spend lives in memory only.
+func Open(p string) error {
+	var f file
+	if err := store.ReadJSON(p, &f); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	path = p
+	for _, b := range f.Buckets {
+		buckets[bucketKey(b.Hour, b.Identity, b.Route, b.Model)] = b
+	}
+	mu.Unlock()
+
+	openOnce.Do(func() {
+		go func() {
+			for range time.Tick(flushInterval) {
+				if err := Flush(); err != nil {
+					logger.Errorf("[Billing] failed to persist usage: %v", err)
+				}
+			}
+		}()
+	})
+
+	logger.Infof("[Billing] usage loaded from %s, buckets=%d", p, len(f.Buckets))
+	return nil
+}
+
+// Flush drops expired buckets and writes the rest to disk when they changed
+func Flush() error {
+	flushMu.Lock()
+	defer flushMu.Unlock()
+
+	cutoff := time.Now().Add(-retention)
+
+	mu.Lock()
+	if path == "" || !dirty {
+		mu.Unlock()
+		return nil
+	}
+	f := file{Buckets: make([]*Bucket, 0, len(buckets))}
+	for k, b := range buckets {
+		if b.Hour.Before(cutoff) {
+			delete(buckets, k)
+			continue
+		}
+		cp := *b
+		f.Buckets = append(f.Buckets, &cp)
+	}
+	p := path
+	dirty = false
+	mu.Unlock()
+
+	sort.Slice(f.Buckets, func(i, j int) bool {
+		a, b := f.Buckets[i], f.Buckets[j]
+		return bucketKey(a.Hour, a.Identity, a.Route, a.Model) < bucketKey(b.Hour, b.Identity, b.Route, b.Model)
+	})
+
+	if err := store.WriteJSON(p, f); err != nil {
+		mu.Lock()
+		dirty = true
+		mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Record adds one request to its hourly bucket
+func Record(e Entry) {
+	hour := e.Time.UTC().Truncate(time.Hour)
+	k := bucketKey(hour, e.Identity, e.Route, e.Usage.Model)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	b, ok := buckets[k]
+	if !ok {
+		b = &Bucket{Hour: hour, Identity: e.Identity, Route: e.Route, Model: e.Usage.Model}
+		buckets[k] = b
+	}
+	if e.Owner != "" {
+		b.Owner = e.Owner
+	}
+
+	b.Requests++
+	if !e.Priced {
+		b.UnpricedRequests++
+	}
+	b.PromptTokens += int64(e.Usage.PromptTokens)
+	b.CompletionTokens += int64(e.Usage.CompletionTokens)
+	b.CachedTokens += int64(e.Usage.CachedTokens)
+	b.TotalTokens += int64(e.Usage.TotalTokens)
+	b.Cost += e.Cost
+	dirty = true
+}
+
+// Query sums the buckets with an hour in [from, to) by the groupBy
+// dimensions, most expensive groups first
+func Query(from, to time.Time, groupBy []string) ([]Row, error) {
+	for _, g := range groupBy {
+		switch g {
+		case GroupIdentity, GroupOwner, GroupRoute, GroupModel, GroupDay, GroupHour:
+		default:
+			return nil, fmt.Errorf("unknown group_by '%s'", g)
+		}
+	}
+	from = from.UTC().Truncate(time.Hour)
+
+	rows := make(map[string]*Row)
+	mu.Lock()
+	for _, b := range buckets {
+		if b.Hour.Before(from) || !b.Hour.Before(to) {
+			continue
+		}
+
+		var r Row
+		for _, g := range groupBy {
+			switch g {
+			case GroupIdentity:
+				r.Identity = b.Identity
+			case GroupOwner:
+				r.Owner = b.Owner
+			case GroupRoute:
+				r.Route = b.Route
+			case GroupModel:
+				r.Model = b.Model
+			case GroupDay:
+				r.Day = b.Hour.Format("2006-01-02")
+			case GroupHour:
+				r.Hour = b.Hour.Format(time.RFC3339)
+			}
+		}
+
+		k := r.key()
+		row, ok := rows[k]
+		if !ok {
+			row = &r
+			rows[k] = row
+		}
+		row.add(b.Totals)
+	}
+	mu.Unlock()
+
+	list := make([]Row, 0, len(rows))
+	for _, r := range rows {
+		list = append(list, *r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Cost != list[j].Cost {
+			return list[i].Cost > list[j].Cost
+		}
+		if list[i].TotalTokens != list[j].TotalTokens {
+			return list[i].TotalTokens > list[j].TotalTokens
+		}
+		return list[i].key() < list[j].key()
+	})
+	return list, nil
+}
+
+func (r *Row) key() string {
+	return strings.Join([]string{r.Identity, r.Owner, r.Route, r.Model, r.Day, r.Hour}, "|")
+}
+
+func (r *Row) add(t Totals) {
+	r.Requests += t.Requests
+	r.UnpricedRequests += t.UnpricedRequests
+	r.PromptTokens += t.PromptTokens
+	r.CompletionTokens += t.CompletionTokens
+	r.CachedTokens += t.CachedTokens
+	r.TotalTokens += t.TotalTokens
+	r.Cost += t.Cost
+}
+
+func bucketKey(hour time.Time, identity, route, model string) string {
+	return hour.UTC().Format(time.RFC3339) + "|" + identity + "|" + route + "|" + model
+}
@@ -0,0 +1,53 @@
+package billing
+
+import (
+	"github.com/poixeai/proxify/infra/config"
+	"github.com/poixeai/proxify/infra/usage"
+	"github.com/poixeai/proxify/util"
+)
+
+// PriceFor finds the price of model, route prices take precedence over the
+// top-level table. Exact names win over globs, and longer globs over shorter.
+func PriceFor(cfg *config.RoutesConfig, route *config.Route, model string) (config.Price, bool) {
+	if model == "" {
+		return config.Price{}, false
+	}
+	if route != nil {
+		if p, ok := lookup(route.Prices, model); ok {
+			return p, true
+		}
+	}
+	if cfg != nil {
+		return lookup(cfg.Prices, model)
+	}
+	return config.Price{}, false
+}
+
+func lookup(prices map[string]config.Price, model string) (config.Price, bool) {
+	if p, ok := prices[model]; ok {
+		return p, true
+	}
+
+	best, found := "", false
+	for pattern := range prices {
+		if util.MatchGlob(pattern, model) && (!found || len(pattern) > len(best) || (len(pattern) == len(best) && pattern < best)) {
+			best, found = pattern, true
+		}
+	}
+	return prices[best], found
+}
+
+// Cost returns the USD cost of u, cached prompt tokens use the cached price
+func Cost(p config.Price, u *usage.Usage) float64 {
+	cachedPrice := p.CachedInput
+	if cachedPrice == 0 {
+		cachedPrice = p.Input
+	}
+
+	cached := min(u.CachedTokens, u.PromptTokens)
+	uncached := u.PromptTokens - cached
+
+	return (float64(uncached)*p.Input +
+		float64(cached)*cachedPrice +
+		float64(u.CompletionTokens)*p.Output) / 1e6
+}
@@ -0,0 +1,339 @@
+package breaker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/poixeai/proxify/infra/config"
+	"github.com/poixeai/proxify/infra/logger"
+)
+
+type State string
+
+const (
+	StateClosed   State = "closed"
+	StateOpen     State = "open"
+	StateHalfOpen State = "half_open"
+)
+
+const (
+	defaultWindow                = 60 * time.Second
+	defaultMinRequests           = 20
+	defaultErrorRateThreshold    = 0.5
+	defaultSlowCallRateThreshold = 0.5
+	defaultOpenDuration          = 30 * time.Second
+	defaultHalfOpenRequests      = 1
+
+	// the sliding window is split into buckets that expire one by one
+	bucketCount = 10
+)
+
+type settings struct {
+	window                time.Duration
+	minRequests           int
+	errorRateThreshold    float64
+	slowCallDuration      time.Duration
+	slowCallRateThreshold float64
+	openDuration          time.Duration
+	halfOpenRequests      int
+}
+
+func newSettings(cfg config.CircuitBreaker) settings {
+	s := settings{
+		window:                cfg.Window.Or(defaultWindow),
+		minRequests:           cfg.MinRequests,
+		errorRateThreshold:    cfg.ErrorRateThreshold,
+		slowCallDuration:      cfg.SlowCallDuration.Std(),
+		slowCallRateThreshold: cfg.SlowCallRateThreshold,
+		openDuration:          cfg.OpenDuration.Or(defaultOpenDuration),
+		halfOpenRequests:      cfg.HalfOpenRequests,
+	}
+	if s.minRequests <= 0 {
+		s.minRequests = defaultMinRequests
+	}
+	if s.errorRateThreshold <= 0 {
+		s.errorRateThreshold = defaultErrorRateThreshold
+	}
+	if s.slowCallRateThreshold <= 0 {
+		s.slowCallRateThreshold = defaultSlowCallRateThreshold
+	}
+	if s.halfOpenRequests <= 0 {
+		s.halfOpenRequests = defaultHalfOpenRequests
+	}
+	return s
+}
+
+type bucket struct {
+	start    time.Time
+	total    int
+	failures int
+	slow     int
+}
+
+// Breaker is the circuit breaker of one route
+type Breaker struct {
+	mu       sync.Mutex
+	route    string
+	settings settings
+
+	state     State
+	changedAt time.Time
+	gen       uint64 // bumped on every state change, stale permits are ignored
+
+	buckets []bucket
+
+	halfOpenInflight  int
+	halfOpenSuccesses int
+}
+
+// Permit is handed out by Allow and must be completed with Done or Cancel.
+// Only the first call counts, so callers can defer Cancel right after Allow
+// and still report the outcome with Done.
+type Permit struct {
+	b        *Breaker
+	gen      uint64
+	probe    bool
+	released bool
+}
+
+func New(route string, cfg config.CircuitBreaker) *Breaker {
+	return &Breaker{
+		route:     route,
+		settings:  newSettings(cfg),
+		state:     StateClosed,
+		changedAt: time.Now(),
+		buckets:   make([]bucket, bucketCount),
+	}
+}
+
+// Allow reports whether a request may go upstream. While open it fails fast,
+// while half-open only a limited number of probe requests pass.
+func (b *Breaker) Allow() (*Permit, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if b.state == StateOpen && now.Sub(b.changedAt) >= b.settings.openDuration {
+		b.transition(StateHalfOpen, now, "open duration elapsed")
+	}
+
+	switch b.state {
+	case StateOpen:
+		return nil, false
+	case StateHalfOpen:
+		if b.halfOpenInflight >= b.settings.halfOpenRequests {
+			return nil, false
+		}
+		b.halfOpenInflight++
+		return &Permit{b: b, gen: b.gen, probe: true}, true
+	default:
+		return &Permit{b: b, gen: b.gen}, true
+	}
+}
+
+// Done records the outcome of an allowed request
+func (p *Permit) Done(success bool, latency time.Duration) {
+	if p == nil || p.released {
+		return
+	}
+	p.released = true
+	p.b.record(p, success, latency)
+}
+
+// Cancel gives the permit back without recording an outcome, used when
+// the request ends before the upstream answered
+func (p *Permit) Cancel() {
+	if p == nil || p.released {
+		return
+	}
+	p.released = true
+	if !p.probe {
+		return
+	}
+
+	b := p.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if p.gen == b.gen {
+		b.halfOpenInflight--
+	}
+}
+
+func (b *Breaker) record(p *Permit, success bool, latency time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// state changed since the permit was handed out
+	if p.gen != b.gen {
+		return
+	}
+
+	now := time.Now()
+	slow := b.settings.slowCallDuration > 0 && latency >= b.settings.slowCallDuration
+
+	if p.probe {
+		b.halfOpenInflight--
+		if !success || slow {
+			b.transition(StateOpen, now, fmt.Sprintf("half-open probe failed (success=%v, latency=%v)", success, latency))
+			return
+		}
+		b.halfOpenSuccesses++
+		if b.halfOpenSuccesses >= b.settings.halfOpenRequests {
+			b.transition(StateClosed, now, "half-open probes succeeded")
+		}
+		return
+	}
+
+	bk := b.currentBucket(now)
+	bk.total++
+	if !success {
+		bk.failures++
+	}
+	if slow {
+		bk.slow++
+	}
+
+	total, failures, slowCalls := b.counts(now)
+	if total < b.settings.minRequests {
+		return
+	}
+
+	errorRate := float64(failures) / float64(total)
+	slowRate := float64(slowCalls) / float64(total)
+	if errorRate >= b.settings.errorRateThreshold {
+		b.transition(StateOpen, now, fmt.Sprintf("error rate %.2f over %d requests", errorRate, total))
+	} else if b.settings.slowCallDuration > 0 && slowRate >= b.settings.slowCallRateThreshold {
+		b.transition(StateOpen, now, fmt.Sprintf("slow call rate %.2f over %d requests", slowRate, total))
+	}
+}
+
+func (b *Breaker) bucketSpan() time.Duration {
+	span := b.settings.window / bucketCount
+	if span <= 0 {
+		span = time.Millisecond
+	}
+	return span
+}
+
+func (b *Breaker) currentBucket(now time.Time) *bucket {
+	span := b.bucketSpan()
+	start := now.Truncate(span)
+	bk := &b.buckets[(start.UnixNano()/int64(span))%bucketCount]
+	if !bk.start.Equal(start) {
+		*bk = bucket{start: start}
+	}
+	return bk
+}
+
+// counts sums the buckets that are still inside the window
+func (b *Breaker) counts(now time.Time) (total, failures, slow int) {
+	for _, bk := range b.buckets {
+		if bk.start.IsZero() || now.Sub(bk.start) >= b.settings.window {
+			continue
+		}
+		total += bk.total
+		failures += bk.failures
+		slow += bk.slow
+	}
+	return
+}
+
+func (b *Breaker) transition(to State, now time.Time, reason string) {
+	from := b.state
+	b.state = to
+	b.changedAt = now
+	b.gen++
+	b.halfOpenInflight = 0
+	b.halfOpenSuccesses = 0
+	if to == StateClosed {
+		b.buckets = make([]bucket, bucketCount)
+	}
+
+	if to == StateOpen {
+		logger.Warnf("[Breaker] route=%s %s -> %s: %s", b.route, from, to, reason)
+	} else {
+		logger.Infof("[Breaker] route=%s %s -> %s: %s", b.route, from, to, reason)
+	}
+}
+
+// State returns the current state
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Status is a point-in-time view of a breaker
+type Status struct {
+	Route     string    `json:"route"`
+	State     State     `json:"state"`
+	Since     time.Time `json:"since"`
+	Requests  int       `json:"requests"`
+	Failures  int       `json:"failures"`
+	SlowCalls int       `json:"slow_calls"`
+	ErrorRate float64   `json:"error_rate"`
+}
+
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	total, failures, slow := b.counts(time.Now())
+	st := Status{
+		Route:     b.route,
+		State:     b.state,
+		Since:     b.changedAt,
+		Requests:  total,
+		Failures:  failures,
+		SlowCalls: slow,
+	}
+	if total > 0 {
+		st.ErrorRate = float64(failures) / float64(total)
+	}
+	return st
+}
+
+/* --------------------- Registry ---------------------- */
+
+type entry struct {
+	cfg     config.CircuitBreaker
+	breaker *Breaker
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]*entry) // route path -> breaker
+)
+
+// For returns the breaker of a route, or nil when the route has none.
+// The breaker is rebuilt when its config changes after a hot reload.
+func For(route *config.Route) *Breaker {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if route.CircuitBreaker == nil {
+		delete(registry, route.Path)
+		return nil
+	}
+
+	cfg := *route.CircuitBreaker
+	if e, ok := registry[route.Path]; ok && e.cfg == cfg {
+		return e.breaker
+	}
+
+	b := New(route.Path, cfg)
+	registry[route.Path] = &entry{cfg: cfg, breaker: b}
+	return b
+}
+
+// Snapshot returns the status of the breaker of every configured route
+func Snapshot(cfg *config.RoutesConfig) []Status {
+	list := make([]Status, 0)
+	for i := range cfg.Routes {
+		if b := For(&cfg.Routes[i]); b != nil {
+			list = append(list, b.Status())
+		}
+	}
+	return list
+}
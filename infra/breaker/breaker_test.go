@@ -0,0 +1,119 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/poixeai/proxify/infra/config"
+)
+
+func TestBreakerOpensOnErrorRateAndClosesAfterProbe(t *testing.T) {
+	b := New("/openai", config.CircuitBreaker{
+		MinRequests:        4,
+		ErrorRateThreshold: 0.5,
+		OpenDuration:       config.Duration(20 * time.Millisecond),
+	})
+
+	for _, success := range []bool{true, false, true, false} {
+		permit, ok := b.Allow()
+		if !ok {
+			t.Fatal("expected closed breaker to allow requests")
+		}
+		permit.Done(success, time.Millisecond)
+	}
+
+	if b.State() != StateOpen {
+		t.Fatalf("expected breaker to open at 50%% errors, got %s", b.State())
+	}
+	if _, ok := b.Allow(); ok {
+		t.Fatal("expected open breaker to fail fast")
+	}
+
+	time.Sleep(25 * time.Millisecond)
+
+	probe, ok := b.Allow()
+	if !ok || b.State() != StateHalfOpen {
+		t.Fatalf("expected a half-open probe, got ok=%v state=%s", ok, b.State())
+	}
+	if _, ok := b.Allow(); ok {
+		t.Fatal("expected only one concurrent half-open probe")
+	}
+
+	probe.Done(true, time.Millisecond)
+	if b.State() != StateClosed {
+		t.Fatalf("expected successful probe to close the breaker, got %s", b.State())
+	}
+}
+
+func TestBreakerOpensOnSlowCalls(t *testing.T) {
+	b := New("/openai", config.CircuitBreaker{
+		MinRequests:      2,
+		SlowCallDuration: config.Duration(100 * time.Millisecond),
+	})
+
+	for i := 0; i < 2; i++ {
+		permit, _ := b.Allow()
+		permit.Done(true, time.Second)
+	}
+
+	if b.State() != StateOpen {
+		t.Fatalf("expected slow calls to open the breaker, got %s", b.State())
+	}
+}
+
+func TestBreakerReopensWhenProbeFails(t *testing.T) {
+	b := New("/openai", config.CircuitBreaker{
+		MinRequests:  1,
+		OpenDuration: config.Duration(time.Millisecond),
+	})
+
+	permit, _ := b.Allow()
+	permit.Done(false, 0)
+	time.Sleep(2 * time.Millisecond)
+
+	probe, ok := b.Allow()
+	if !ok {
+		t.Fatal("expected half-open probe to be allowed")
+	}
+
+	// permits handed out before the state change are ignored
+	permit.Done(true, 0)
+
+	probe.Done(false, 0)
+	if b.State() != StateOpen {
+		t.Fatalf("expected failed probe to reopen the breaker, got %s", b.State())
+	}
+}
+
+func TestBreakerReleasesProbeOnEarlyReturn(t *testing.T) {
+	b := New("/openai", config.CircuitBreaker{
+		MinRequests:  1,
+		OpenDuration: config.Duration(time.Millisecond),
+	})
+
+	permit, _ := b.Allow()
+	permit.Done(false, 0)
+	time.Sleep(2 * time.Millisecond)
+
+	// a request that bails out before reaching the upstream
+	func() {
+		probe, ok := b.Allow()
+		if !ok {
+			t.Fatal("expected half-open probe to be allowed")
+		}
+		defer probe.Cancel()
+	}()
+
+	probe, ok := b.Allow()
+	if !ok {
+		t.Fatal("expected the abandoned probe to be given back")
+	}
+	defer probe.Cancel()
+
+	// Cancel after Done is a no-op and must not free a second probe slot
+	probe.Done(true, 0)
+	probe.Cancel()
+	if b.State() != StateClosed {
+		t.Fatalf("expected successful probe to close the breaker, got %s", b.State())
+	}
+}
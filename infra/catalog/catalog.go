@@ -0,0 +1,214 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/poixeai/proxify/infra/config"
+	"github.com/poixeai/proxify/infra/credential"
+	"github.com/poixeai/proxify/infra/logger"
+	"github.com/poixeai/proxify/infra/modelpolicy"
+	"github.com/poixeai/proxify/infra/transport"
+	"github.com/poixeai/proxify/util"
+)
+
+const (
+	// how long an upstream model list is reused
+	cacheTTL = 10 * time.Minute
+	// failed fetches are retried sooner
+	errorTTL = time.Minute
+
+	fetchTimeout = 5 * time.Second
+	maxListSize  = 4 << 20
+)
+
+// Model is one entry of an OpenAI-format model list
+type Model struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+type cached struct {
+	models  []Model
+	expires time.Time
+}
+
+var (
+	mu    sync.Mutex
+	cache = make(map[string]cached) // route path + endpoint url -> fetched models
+)
+
+// List merges the models of every route: declared models, model_map aliases,
+// exact model routing rules and the upstream lists of routes with a
+// models_endpoint. Each model is listed once, owned by the first route
+// serving it; models a route's model_policy rejects are left out.
+func List(ctx context.Context, cfg *config.RoutesConfig) []Model {
+	// fetch upstream lists in parallel, the rest is local
+	fetched := make([][]Model, len(cfg.Routes))
+	var wg sync.WaitGroup
+	for i := range cfg.Routes {
+		if cfg.Routes[i].ModelsEndpoint == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			fetched[i] = upstreamModels(ctx, &cfg.Routes[i])
+		}(i)
+	}
+	wg.Wait()
+
+	var list []Model
+	seen := make(map[string]bool)
+	add := func(r *config.Route, id string, created int64) {
+		if id == "" || seen[id] || !modelpolicy.For(r).Allowed(id) {
+			return
+		}
+		seen[id] = true
+		list = append(list, Model{ID: id, Object: "model", Created: created, OwnedBy: ownerOf(r)})
+	}
+
+	for i := range cfg.Routes {
+		r := &cfg.Routes[i]
+
+		for _, m := range r.Models {
+			add(r, m, 0)
+		}
+
+		aliases := make([]string, 0, len(r.ModelMap))
+		for alias := range r.ModelMap {
+			aliases = append(aliases, alias)
+		}
+		sort.Strings(aliases)
+		for _, alias := range aliases {
+			add(r, alias, 0)
+		}
+
+		for _, m := range fetched[i] {
+			add(r, m.ID, m.Created)
+		}
+	}
+
+	// exact rules name models even when no route declares them
+	if mr := cfg.ModelRouting; mr != nil {
+		for _, rule := range mr.Rules {
+			if strings.ContainsAny(rule.Model, "*?") {
+				continue
+			}
+			if r := cfg.RouteByPath(rule.Route); r != nil {
+				add(r, rule.Model, 0)
+			}
+		}
+	}
+
+	if list == nil {
+		list = []Model{}
+	}
+	return list
+}
+
+func ownerOf(r *config.Route) string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return strings.TrimPrefix(r.Path, "/")
+}
+
+// upstreamModels returns the cached model list of a route, fetching it from
+// the first upstream target when it expired
+func upstreamModels(ctx context.Context, r *config.Route) []Model {
+	targets := r.Upstreams()
+	if len(targets) == 0 {
+		return nil
+	}
+	t := targets[0]
+	url := util.JoinURL(t.URL, r.ModelsEndpoint)
+	key := r.Path + "|" + url
+
+	mu.Lock()
+	c, ok := cache[key]
+	mu.Unlock()
+	if ok && time.Now().Before(c.expires) {
+		return c.models
+	}
+
+	models, err := fetch(ctx, r, url, r.CredentialFor(t))
+	ttl := cacheTTL
+	if err != nil {
+		logger.Warnf("[Catalog] route=%s failed to fetch models from %s: %v", r.Path, url, err)
+		ttl = errorTTL
+		// keep serving the last good list
+		models = c.models
+	}
+
+	mu.Lock()
+	cache[key] = cached{models: models, expires: time.Now().Add(ttl)}
+	mu.Unlock()
+	return models
+}
+
+func fetch(ctx context.Context, r *config.Route, url string, cred *config.Credential) ([]Model, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if cred != nil {
+		if err := credential.Apply(req, cred, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := transport.Client(r).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxListSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return parseList(body)
+}
+
+// parseList reads openai and anthropic ({"data":[{"id"}]}) as well as
+// gemini ({"models":[{"name":"models/..."}]}) model lists
+func parseList(body []byte) ([]Model, error) {
+	var v struct {
+		Data []struct {
+			ID      string `json:"id"`
+			Created int64  `json:"created"`
+		} `json:"data"`
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil, err
+	}
+
+	var out []Model
+	for _, m := range v.Data {
+		out = append(out, Model{ID: m.ID, Created: m.Created})
+	}
+	for _, m := range v.Models {
+		out = append(out, Model{ID: strings.TrimPrefix(m.Name, "models/")})
+	}
+	return out, nil
+}
@@ -0,0 +1,74 @@
+package catalog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/poixeai/proxify/infra/config"
+)
+
+func TestListMergesRoutes(t *testing.T) {
+	var calls atomic.Int32
+	openai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path != "/v1/models" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"object":"list","data":[{"id":"gpt-4o","created":1715367049},{"id":"gpt-4o-mini","created":1721172741}]}`))
+	}))
+	defer openai.Close()
+
+	gemini := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"models":[{"name":"models/gemini-2.5-pro"}]}`))
+	}))
+	defer gemini.Close()
+
+	cfg := &config.RoutesConfig{
+		Routes: []config.Route{
+			{
+				Path: "/openai", Name: "OpenAI", Target: openai.URL,
+				Models:         []string{"gpt-4.1"},
+				ModelMap:       map[string]string{"fast": "gpt-4o-mini"},
+				ModelsEndpoint: "/v1/models",
+			},
+			{Path: "/gemini", Target: gemini.URL, ModelsEndpoint: "/v1beta/models"},
+			{Path: "/claude", Name: "Claude", Target: "http://127.0.0.1:1", Models: []string{"gpt-4o"}},
+		},
+		ModelRouting: &config.ModelRouting{
+			Path: "/v1",
+			Rules: []config.ModelRule{
+				{Model: "claude-sonnet-4-5", Route: "/claude"},
+				{Model: "claude-*", Route: "/claude"},
+			},
+		},
+	}
+
+	list := List(context.Background(), cfg)
+
+	want := []Model{
+		{ID: "gpt-4.1", Object: "model", OwnedBy: "OpenAI"},
+		{ID: "fast", Object: "model", OwnedBy: "OpenAI"},
+		{ID: "gpt-4o", Object: "model", Created: 1715367049, OwnedBy: "OpenAI"},
+		{ID: "gpt-4o-mini", Object: "model", Created: 1721172741, OwnedBy: "OpenAI"},
+		{ID: "gemini-2.5-pro", Object: "model", OwnedBy: "gemini"},
+		{ID: "claude-sonnet-4-5", Object: "model", OwnedBy: "Claude"},
+	}
+	if len(list) != len(want) {
+		t.Fatalf("expected %d models, got %+v", len(want), list)
+	}
+	for i := range want {
+		if list[i] != want[i] {
+			t.Errorf("model %d: expected %+v, got %+v", i, want[i], list[i])
+		}
+	}
+
+	// the upstream list is cached
+	List(context.Background(), cfg)
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected one upstream fetch, got %d", n)
+	}
+}
@@ -1,17 +1,30 @@
 package config
 
 import (
+	"crypto/subtle"
 	"net"
 	"os"
 	"strings"
 )
 
+const (
+	AdminTokenEnv    = "AUTH_ADMIN_TOKEN"
+	AdminTokenHeader = "X-Admin-Token"
+)
+
 type AuthConfig struct {
 	IPWhitelistRaw string
 	IPNets         []*net.IPNet
 
 	TokenHeader string
 	TokenKey    string
+
+	// per-consumer keys (optional)
+	KeysPath string
+	Keys     *APIKeyStore
+
+	// token for the management endpoints, sent in AdminTokenHeader (optional)
+	AdminToken string
 }
 
 func LoadAuthConfig() (*AuthConfig, error) {
@@ -19,6 +32,17 @@ func LoadAuthConfig() (*AuthConfig, error) {
 		IPWhitelistRaw: strings.TrimSpace(os.Getenv("AUTH_IP_WHITELIST")),
 		TokenHeader:    strings.TrimSpace(os.Getenv("AUTH_TOKEN_HEADER")),
 		TokenKey:       strings.TrimSpace(os.Getenv("AUTH_TOKEN_KEY")),
+		KeysPath:       strings.TrimSpace(os.Getenv(APIKeysPathEnv)),
+		AdminToken:     strings.TrimSpace(os.Getenv(AdminTokenEnv)),
+	}
+
+	// load api keys
+	if cfg.KeysPath != "" {
+		keys, err := LoadAPIKeys(cfg.KeysPath)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Keys = keys
 	}
 
 	// parse ip whitelist
@@ -45,3 +69,13 @@ func LoadAuthConfig() (*AuthConfig, error) {
 
 	return cfg, nil
 }
+
+// TokenAuthEnabled reports whether requests must carry a token in TokenHeader
+func (cfg *AuthConfig) TokenAuthEnabled() bool {
+	return cfg.TokenKey != "" || cfg.Keys != nil
+}
+
+// IsAdmin reports whether token is the configured admin token
+func (cfg *AuthConfig) IsAdmin(token string) bool {
+	return cfg.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) == 1
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// IsConfigFile reports whether a file in a config directory is loaded,
+// hidden files like the temp files of atomic writes are skipped
+func IsConfigFile(name string) bool {
+	base := filepath.Base(name)
+	if strings.HasPrefix(base, ".") {
+		return false
+	}
+	switch strings.ToLower(filepath.Ext(base)) {
+	case ".json", ".yaml", ".yml", ".toml":
+		return true
+	}
+	return false
+}
+
+// configFiles lists the config files of dir in name order
+func configFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && IsConfigFile(e.Name()) {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	return files, nil
+}
+
+// LoadRoutesDir merges every config file of dir into one config. Routes keep
+// the file name order. A route path, a price or model_routing defined in
+// more than one file is a conflict, all conflicts are reported together.
+func LoadRoutesDir(dir string) (*RoutesConfig, error) {
+	files, err := configFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := &RoutesConfig{Routes: []Route{}}
+	routeFiles := make(map[string]string) // route path -> file
+	priceFiles := make(map[string]string) // model -> file
+	routingFile := ""
+	var conflicts []error
+	for _, file := range files {
+		cfg, err := LoadRoutesConfig(file)
+		if err != nil {
+			return nil, err
+		}
+		data, _ := os.ReadFile(file)
+		conflict := func(path, format string, args ...any) {
+			fe := FieldErrorf(path, format, args...)
+			fe.File = file
+			conflicts = append(conflicts, withLocation(data, DetectFormat(file, data), fe))
+		}
+
+		for i, r := range cfg.Routes {
+			if other, ok := routeFiles[r.Path]; ok && other != file {
+				conflict(JoinPath(JoinPath("routes", i), "path"), "path '%s' is also defined in %s", r.Path, other)
+				continue
+			}
+			routeFiles[r.Path] = file
+		}
+		merged.Routes = append(merged.Routes, cfg.Routes...)
+
+		for _, model := range slices.Sorted(maps.Keys(cfg.Prices)) {
+			if other, ok := priceFiles[model]; ok {
+				conflict(MapKeyPath("prices", model), "price is also defined in %s", other)
+				continue
+			}
+			priceFiles[model] = file
+			if merged.Prices == nil {
+				merged.Prices = make(map[string]Price)
+			}
+			merged.Prices[model] = cfg.Prices[model]
+		}
+
+		if cfg.ModelRouting != nil {
+			if routingFile != "" {
+				conflict("model_routing", "is also defined in %s", routingFile)
+				continue
+			}
+			routingFile = file
+			merged.ModelRouting = cfg.ModelRouting
+		}
+	}
+	if len(conflicts) > 0 {
+		return nil, errors.Join(conflicts...)
+	}
+	return merged, nil
+}
+
+// locateInDir maps a field path of the merged config of dir back to the
+// file that defines it, and the path within that file
+func locateInDir(dir, path string) (string, string) {
+	files, err := configFiles(dir)
+	if err != nil {
+		return "", path
+	}
+
+	elems, ok := splitPath(path)
+	if !ok || len(elems) == 0 {
+		return "", path
+	}
+
+	offset := 0
+	for _, file := range files {
+		cfg, err := LoadRoutesConfig(file)
+		if err != nil {
+			continue
+		}
+		switch elems[0] {
+		case "routes":
+			i, ok := elemAt(elems, 1)
+			if !ok {
+				return "", path
+			}
+			if i < offset+len(cfg.Routes) {
+				local := JoinPath("routes", i-offset)
+				return file, local + strings.TrimPrefix(path, JoinPath("routes", i))
+			}
+			offset += len(cfg.Routes)
+		case "prices":
+			if model, ok := elemString(elems, 1); ok {
+				if _, ok := cfg.Prices[model]; ok {
+					return file, path
+				}
+			}
+		case "model_routing":
+			if cfg.ModelRouting != nil {
+				return file, path
+			}
+		}
+	}
+	return "", path
+}
+
+func elemAt(elems []any, i int) (int, bool) {
+	if i >= len(elems) {
+		return 0, false
+	}
+	n, ok := elems[i].(int)
+	return n, ok
+}
+
+func elemString(elems []any, i int) (string, bool) {
+	if i >= len(elems) {
+		return "", false
+	}
+	s, ok := elems[i].(string)
+	return s, ok
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
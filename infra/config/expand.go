@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// ExpandEnv replaces ${VAR} and ${VAR:-default} in s. The default is used
+// when VAR is unset or empty, a reference without a default to an unset
+// variable is an error so a missing secret never turns into an empty
+// string. $${ is kept as a literal ${.
+func ExpandEnv(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1])
+			b.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated ${ in %q", s)
+		}
+		ref := s[i+2 : i+end]
+		name, def, hasDef := strings.Cut(ref, ":-")
+		if !validEnvName(name) {
+			return "", fmt.Errorf("invalid variable name %q", name)
+		}
+
+		value, ok := os.LookupEnv(name)
+		switch {
+		case hasDef && value == "":
+			value = def
+		case !ok:
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+
+		b.WriteString(s[:i])
+		b.WriteString(value)
+		s = s[i+end+1:]
+	}
+}
+
+// HasEnvRefs reports whether data contains ${...} references
+func HasEnvRefs(data []byte) bool {
+	s := string(data)
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			return false
+		}
+		if i == 0 || s[i-1] != '$' {
+			return true
+		}
+		s = s[i+2:]
+	}
+}
+
+// EscapeEnv writes every ${ of s as $${, so ExpandEnv gives s back
+func EscapeEnv(s string) string {
+	return strings.ReplaceAll(s, "${", "$${")
+}
+
+// EscapeEnvRefs escapes every string value of cfg in place before it is
+// written to a file. The values are already expanded, a ${ left in them is
+// literal and must not be expanded again when the file is reloaded.
+func EscapeEnvRefs(cfg *RoutesConfig) {
+	escapeValue(reflect.ValueOf(cfg).Elem())
+}
+
+func escapeValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			escapeValue(v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).CanSet() {
+				escapeValue(v.Field(i))
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			escapeValue(v.Index(i))
+		}
+	case reflect.Map:
+		// map values are not addressable, escape a copy and put it back
+		iter := v.MapRange()
+		for iter.Next() {
+			item := reflect.New(iter.Value().Type()).Elem()
+			item.Set(iter.Value())
+			escapeValue(item)
+			v.SetMapIndex(iter.Key(), item)
+		}
+	case reflect.String:
+		v.SetString(EscapeEnv(v.String()))
+	}
+}
+
+func validEnvName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, c := range name {
+		if c != '_' && (c < 'A' || c > 'Z') && (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
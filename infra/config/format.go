@@ -0,0 +1,168 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+)
+
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+	FormatTOML Format = "toml"
+)
+
+// a TOML file opens with a table header or a top level key = value line
+var tomlStart = regexp.MustCompile(`^(\[\[?[A-Za-z0-9_."-]+\]\]?|[A-Za-z0-9_"-]+\s*=)`)
+
+// DetectFormat picks the config format from the file extension, or from
+// the content when the extension is unknown
+func DetectFormat(path string, data []byte) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "{"):
+			return FormatJSON
+		case tomlStart.MatchString(line):
+			return FormatTOML
+		}
+		break
+	}
+	return FormatYAML
+}
+
+// ParseRoutesConfigFormat decodes a routes config written in format. Keys
+// are the same in every format, and ${VAR} / ${VAR:-default} references in
+// string values are replaced from the environment.
+func ParseRoutesConfigFormat(data []byte, format Format) (*RoutesConfig, error) {
+	return parseRoutesConfig(data, format, true)
+}
+
+func parseRoutesConfig(data []byte, format Format, expand bool) (*RoutesConfig, error) {
+	var (
+		tree any
+		err  error
+	)
+	switch format {
+	case FormatJSON:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err = dec.Decode(&tree); err == nil {
+			if _, extra := dec.Token(); extra != io.EOF {
+				rest := bytes.TrimLeft(data[dec.InputOffset():], " \t\r\n")
+				line, col := lineCol(data, len(data)-len(rest))
+				err = &FieldError{Line: line, Column: col, Msg: "unexpected data after the top-level object"}
+			}
+		}
+	case FormatYAML:
+		err = yaml.Unmarshal(data, &tree)
+	case FormatTOML:
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return nil, fmt.Errorf("unknown config format %q", format)
+	}
+	if err != nil {
+		return nil, syntaxError(data, format, err)
+	}
+
+	if expand {
+		if tree, err = interpolate(tree, ""); err != nil {
+			return nil, withLocation(data, format, err)
+		}
+	}
+	if err := checkTree(tree, reflect.TypeFor[RoutesConfig](), ""); err != nil {
+		return nil, withLocation(data, format, err)
+	}
+
+	// decode through JSON so every format shares the json tags and custom types
+	normalized, err := json.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+	var cfg RoutesConfig
+	if err := json.Unmarshal(normalized, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// syntaxError reports where a document failed to parse
+func syntaxError(data []byte, format Format, err error) error {
+	var (
+		fe        *FieldError
+		jsonErr   *json.SyntaxError
+		decodeErr *toml.DecodeError
+	)
+	switch {
+	case errors.As(err, &fe):
+		return fe
+	case errors.As(err, &jsonErr):
+		line, col := lineCol(data, int(jsonErr.Offset))
+		return &FieldError{Line: line, Column: col, Msg: "invalid json: " + jsonErr.Error()}
+	case errors.As(err, &decodeErr):
+		line, col := decodeErr.Position()
+		return &FieldError{Line: line, Column: col, Msg: "invalid toml: " + decodeErr.Error()}
+	}
+	// yaml errors carry their own [line:column]
+	return &FieldError{Msg: fmt.Sprintf("invalid %s: %v", format, err)}
+}
+
+func withLocation(data []byte, format Format, err error) error {
+	var fe *FieldError
+	if errors.As(err, &fe) && fe.Line == 0 {
+		fe.Line, fe.Column = locate(data, format, fe.Path)
+	}
+	return err
+}
+
+// interpolate expands env references in every string of a decoded tree
+func interpolate(v any, path string) (any, error) {
+	switch val := v.(type) {
+	case string:
+		expanded, err := ExpandEnv(val)
+		if err != nil {
+			return nil, FieldErrorf(path, "%v", err)
+		}
+		return expanded, nil
+	case map[string]any:
+		for k, item := range val {
+			expanded, err := interpolate(item, JoinPath(path, k))
+			if err != nil {
+				return nil, err
+			}
+			val[k] = expanded
+		}
+	case []any:
+		for i, item := range val {
+			expanded, err := interpolate(item, JoinPath(path, i))
+			if err != nil {
+				return nil, err
+			}
+			val[i] = expanded
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const APIKeysPathEnv = "AUTH_KEYS_PATH"
+
+// APIKey is a gateway key issued to one consumer
+type APIKey struct {
+	Name      string     `json:"name"`
+	Owner     string     `json:"owner,omitempty"`
+	Key       string     `json:"key,omitempty"`        // plain key, or
+	KeySHA256 string     `json:"key_sha256,omitempty"` // hex sha256 of the key
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // RFC 3339, never expires when unset
+	Enabled   *bool      `json:"enabled,omitempty"`    // defaults to true
+	Routes    []string   `json:"routes,omitempty"`     // allowed route paths like /openai, all when empty
+
+	hash []byte
+}
+
+type APIKeysConfig struct {
+	Keys []APIKey `json:"keys"`
+}
+
+// APIKeyStore looks up keys by their hash, plain keys are not kept in memory
+type APIKeyStore struct {
+	keys []*APIKey
+}
+
+func (k *APIKey) IsEnabled() bool {
+	return k.Enabled == nil || *k.Enabled
+}
+
+func (k *APIKey) IsExpired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// AllowsRoute reports whether the key may call the given route path
+func (k *APIKey) AllowsRoute(path string) bool {
+	if len(k.Routes) == 0 {
+		return true
+	}
+	for _, r := range k.Routes {
+		if r == "*" || r == path {
+			return true
+		}
+	}
+	return false
+}
+
+func LoadAPIKeys(path string) (*APIKeyStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseAPIKeys(data)
+}
+
+func ParseAPIKeys(data []byte) (*APIKeyStore, error) {
+	var cfg APIKeysConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+
+	store := &APIKeyStore{}
+	seen := make(map[string]bool)
+	for i := range cfg.Keys {
+		k := cfg.Keys[i]
+
+		if k.Name == "" {
+			return nil, fmt.Errorf("invalid api key #%d: empty name", i)
+		}
+		if seen[k.Name] {
+			return nil, fmt.Errorf("invalid api key '%s': duplicate name", k.Name)
+		}
+		seen[k.Name] = true
+
+		switch {
+		case k.Key != "" && k.KeySHA256 != "":
+			return nil, fmt.Errorf("invalid api key '%s': set either key or key_sha256", k.Name)
+		case k.Key != "":
+			if len(k.Key) < 16 {
+				return nil, fmt.Errorf("invalid api key '%s': key is too short (<16)", k.Name)
+			}
+			sum := sha256.Sum256([]byte(k.Key))
+			k.hash = sum[:]
+			k.Key = ""
+		case k.KeySHA256 != "":
+			hash, err := hex.DecodeString(strings.TrimSpace(k.KeySHA256))
+			if err != nil || len(hash) != sha256.Size {
+				return nil, fmt.Errorf("invalid api key '%s': key_sha256 is not a hex sha256", k.Name)
+			}
+			k.hash = hash
+		default:
+			return nil, fmt.Errorf("invalid api key '%s': key or key_sha256 is required", k.Name)
+		}
+
+		store.keys = append(store.keys, &k)
+	}
+
+	return store, nil
+}
+
+// Lookup returns the key matching token, or nil. Every key is compared in
+// constant time so the lookup does not leak how close a guess was.
+func (s *APIKeyStore) Lookup(token string) *APIKey {
+	if s == nil || token == "" {
+		return nil
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	var found *APIKey
+	for _, k := range s.keys {
+		if subtle.ConstantTimeCompare(sum[:], k.hash) == 1 {
+			found = k
+		}
+	}
+	return found
+}
+
+func (s *APIKeyStore) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.keys)
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestParseAPIKeysLookup(t *testing.T) {
+	sum := sha256.Sum256([]byte("ci-key-0123456789abcdef"))
+	data := []byte(`{"keys":[
+		{"name":"alice","owner":"team-a","key":"alice-key-0123456789","routes":["/openai"]},
+		{"name":"ci","key_sha256":"` + hex.EncodeToString(sum[:]) + `","enabled":false},
+		{"name":"old","key":"old-key-0123456789ab","expires_at":"2020-01-01T00:00:00Z"}
+	]}`)
+
+	store, err := ParseAPIKeys(data)
+	if err != nil {
+		t.Fatalf("expected keys to parse, got error: %v", err)
+	}
+	if store.Len() != 3 {
+		t.Fatalf("expected 3 keys, got %d", store.Len())
+	}
+
+	alice := store.Lookup("alice-key-0123456789")
+	if alice == nil || alice.Name != "alice" || alice.Owner != "team-a" {
+		t.Fatalf("expected alice key, got %+v", alice)
+	}
+	if alice.Key != "" {
+		t.Fatal("expected plain key to be dropped after hashing")
+	}
+	if !alice.AllowsRoute("/openai") || alice.AllowsRoute("/claude") {
+		t.Fatal("expected alice to be limited to /openai")
+	}
+
+	if ci := store.Lookup("ci-key-0123456789abcdef"); ci == nil || ci.IsEnabled() {
+		t.Fatalf("expected disabled ci key from sha256, got %+v", ci)
+	}
+	if old := store.Lookup("old-key-0123456789ab"); old == nil || !old.IsExpired(time.Now()) {
+		t.Fatalf("expected expired key, got %+v", old)
+	}
+	if store.Lookup("unknown-key-0123456789") != nil || store.Lookup("") != nil {
+		t.Fatal("expected unknown and empty tokens to be rejected")
+	}
+}
+
+func TestParseAPIKeysRejectsInvalidEntries(t *testing.T) {
+	for name, data := range map[string]string{
+		"missing key":    `{"keys":[{"name":"a"}]}`,
+		"short key":      `{"keys":[{"name":"a","key":"short"}]}`,
+		"duplicate name": `{"keys":[{"name":"a","key":"0123456789abcdef"},{"name":"a","key":"fedcba9876543210"}]}`,
+		"bad sha256":     `{"keys":[{"name":"a","key_sha256":"xyz"}]}`,
+	} {
+		if _, err := ParseAPIKeys([]byte(data)); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// Locate fills in the file, line and column of a FieldError from the
+// source the config was read from. Other errors are returned as is.
+func (s RoutesConfigSource) Locate(err error) error {
+	var fe *FieldError
+	if !errors.As(err, &fe) || fe.File != "" {
+		return err
+	}
+
+	var data []byte
+	switch {
+	case s.Type == RoutesConfigSourceEnv:
+		fe.File = s.Description()
+		data = []byte(s.RawJSON)
+	case isDir(s.Path):
+		// merged index -> the file defining the field and its index there
+		fe.File = s.Path
+		file, path := locateInDir(s.Path, fe.Path)
+		if file == "" {
+			return err
+		}
+		fe.File, fe.Path = file, path
+		if data, err = os.ReadFile(file); err != nil {
+			return fe
+		}
+	default:
+		fe.File = s.Path
+		if data, err = os.ReadFile(s.Path); err != nil {
+			return fe
+		}
+	}
+	if fe.Line == 0 {
+		fe.Line, fe.Column = locate(data, DetectFormat(fe.File, data), fe.Path)
+	}
+	return fe
+}
+
+// locate finds the line and column of a field path in a config document,
+// zeros when it cannot be found
+func locate(data []byte, format Format, path string) (int, int) {
+	elems, ok := splitPath(path)
+	if !ok || len(elems) == 0 {
+		return 0, 0
+	}
+
+	switch format {
+	case FormatJSON:
+		if off, ok := locateJSON(data, elems); ok {
+			return lineCol(data, off)
+		}
+	case FormatYAML:
+		return locateYAML(data, elems)
+	case FormatTOML:
+		return locateTOML(data, elems)
+	}
+	return 0, 0
+}
+
+// splitPath turns routes[2].prices["gpt-4.1"] into routes, 2, prices, gpt-4.1
+func splitPath(path string) ([]any, bool) {
+	var elems []any
+	for path != "" {
+		switch {
+		case strings.HasPrefix(path, "."):
+			path = path[1:]
+		case strings.HasPrefix(path, `["`):
+			key, err := strconv.QuotedPrefix(path[1:])
+			if err != nil || !strings.HasPrefix(path[1+len(key):], "]") {
+				return nil, false
+			}
+			unquoted, _ := strconv.Unquote(key)
+			elems = append(elems, unquoted)
+			path = path[len(key)+2:]
+		case strings.HasPrefix(path, "["):
+			end := strings.IndexByte(path, ']')
+			i, err := strconv.Atoi(path[1:max(end, 1)])
+			if end < 0 || err != nil {
+				return nil, false
+			}
+			elems = append(elems, i)
+			path = path[end+1:]
+		default:
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			elems = append(elems, path[:end])
+			path = path[end:]
+		}
+	}
+	return elems, true
+}
+
+// locateJSON returns the offset of the last key of elems, or of the value
+// when the path ends with an index
+func locateJSON(data []byte, elems []any) (int, bool) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	start := func() int {
+		off := int(dec.InputOffset())
+		for off < len(data) && strings.IndexByte(" \t\r\n,:", data[off]) >= 0 {
+			off++
+		}
+		return off
+	}
+
+	var walk func(elems []any) (int, bool)
+	walk = func(elems []any) (int, bool) {
+		valueStart := start()
+		tok, err := dec.Token()
+		if err != nil {
+			return 0, false
+		}
+		if len(elems) == 0 {
+			return valueStart, true
+		}
+
+		switch tok {
+		case json.Delim('{'):
+			for dec.More() {
+				keyStart := start()
+				key, err := dec.Token()
+				if err != nil {
+					return 0, false
+				}
+				if key == elems[0] {
+					if len(elems) == 1 {
+						return keyStart, true
+					}
+					return walk(elems[1:])
+				}
+				if skipJSON(dec) != nil {
+					return 0, false
+				}
+			}
+		case json.Delim('['):
+			for i := 0; dec.More(); i++ {
+				if i == elems[0] {
+					return walk(elems[1:])
+				}
+				if skipJSON(dec) != nil {
+					return 0, false
+				}
+			}
+		}
+		return 0, false
+	}
+	return walk(elems)
+}
+
+// skipJSON consumes the next value
+func skipJSON(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+func lineCol(data []byte, off int) (int, int) {
+	off = min(off, len(data))
+	line := bytes.Count(data[:off], []byte("\n")) + 1
+	return line, off - bytes.LastIndexByte(data[:off], '\n')
+}
+
+func locateYAML(data []byte, elems []any) (int, int) {
+	file, err := parser.ParseBytes(data, 0)
+	if err != nil || len(file.Docs) == 0 {
+		return 0, 0
+	}
+
+	node := file.Docs[0].Body
+	for i, elem := range elems {
+		if anchor, ok := node.(*ast.AnchorNode); ok {
+			node = anchor.Value
+		}
+
+		var next ast.Node
+		switch n := node.(type) {
+		case *ast.MappingNode:
+			next = yamlValue(n.Values, elem, i == len(elems)-1)
+		case *ast.MappingValueNode:
+			next = yamlValue([]*ast.MappingValueNode{n}, elem, i == len(elems)-1)
+		case *ast.SequenceNode:
+			if idx, ok := elem.(int); ok && idx < len(n.Values) {
+				next = n.Values[idx]
+			}
+		}
+		if next == nil {
+			return 0, 0
+		}
+		node = next
+	}
+
+	pos := node.GetToken().Position
+	return pos.Line, pos.Column
+}
+
+// yamlValue returns the value of key in a mapping, or the key itself for the
+// last path element so errors point at the field name
+func yamlValue(values []*ast.MappingValueNode, key any, last bool) ast.Node {
+	name, ok := key.(string)
+	if !ok {
+		return nil
+	}
+	for _, v := range values {
+		if v.Key.GetToken().Value != name {
+			continue
+		}
+		if last {
+			return v.Key
+		}
+		return v.Value
+	}
+	return nil
+}
+
+// locateTOML finds the line of the last key of elems, when it is assigned
+// exactly once in the file
+func locateTOML(data []byte, elems []any) (int, int) {
+	key, ok := elems[len(elems)-1].(string)
+	if !ok {
+		return 0, 0
+	}
+	re := regexp.MustCompile(`(?m)^[ \t]*["']?` + regexp.QuoteMeta(key) + `["']?[ \t]*=`)
+	matches := re.FindAllIndex(data, 2)
+	if len(matches) != 1 {
+		return 0, 0
+	}
+	off := matches[0][0]
+	for off < len(data) && (data[off] == ' ' || data[off] == '\t') {
+		off++
+	}
+	return lineCol(data, off)
+}
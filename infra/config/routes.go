@@ -1,9 +1,11 @@
 package config
 
 import (
-	"encoding/json"
+	"errors"
 	"os"
 	"strings"
+
+	"github.com/poixeai/proxify/util"
 )
 
 const (
@@ -26,18 +28,298 @@ type RoutesConfigSource struct {
 	RawJSON string
 }
 
+// load balancing strategies for routes with multiple targets
+const (
+	LoadBalanceWeightedRoundRobin = "weighted_round_robin"
+	LoadBalanceLeastRequests      = "least_requests"
+	LoadBalanceRandom             = "random"
+)
+
+// default status codes that make the proxy fail over to the next target
+var DefaultFailoverStatusCodes = []int{429, 500, 502, 503, 529}
+
+// credential types, each injected in the header its provider expects
+const (
+	CredentialTypeBearer    = "bearer"    // Authorization: Bearer <key>, openai and compatible
+	CredentialTypeAnthropic = "anthropic" // x-api-key: <key>
+	CredentialTypeAzure     = "azure"     // api-key: <key>
+	CredentialTypeGemini    = "gemini"    // x-goog-api-key: <key>
+)
+
+// Credential is an upstream provider key held by the gateway
+type Credential struct {
+	Type string `json:"type,omitempty"` // bearer (default) | anthropic | azure | gemini
+	Env  string `json:"env,omitempty"`  // env var holding the key, or
+	File string `json:"file,omitempty"` // file holding the key, like a docker secret
+}
+
+type Target struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight,omitempty"` // defaults to 1
+	Backup bool   `json:"backup,omitempty"` // only used when failing over, never balanced
+
+	// overrides the route credential for this target (optional)
+	Credential *Credential `json:"credential,omitempty"`
+}
+
+type Failover struct {
+	Disabled    bool  `json:"disabled,omitempty"`
+	MaxAttempts int   `json:"max_attempts,omitempty"` // defaults to the number of targets
+	StatusCodes []int `json:"status_codes,omitempty"` // defaults to DefaultFailoverStatusCodes
+}
+
+type HealthCheck struct {
+	Path               string   `json:"path"`                          // probe path joined to each target, like /v1/models
+	Interval           Duration `json:"interval,omitempty"`            // defaults to 30s
+	Timeout            Duration `json:"timeout,omitempty"`             // defaults to 5s
+	ExpectedStatus     int      `json:"expected_status,omitempty"`     // defaults to 200
+	UnhealthyThreshold int      `json:"unhealthy_threshold,omitempty"` // consecutive failures before unhealthy, defaults to 3
+	HealthyThreshold   int      `json:"healthy_threshold,omitempty"`   // consecutive successes before healthy again, defaults to 2
+}
+
+type CircuitBreaker struct {
+	Window                Duration `json:"window,omitempty"`                   // sliding window, defaults to 60s
+	MinRequests           int      `json:"min_requests,omitempty"`             // requests in window before tripping, defaults to 20
+	ErrorRateThreshold    float64  `json:"error_rate_threshold,omitempty"`     // 0-1, defaults to 0.5
+	SlowCallDuration      Duration `json:"slow_call_duration,omitempty"`       // calls slower than this count as slow (optional)
+	SlowCallRateThreshold float64  `json:"slow_call_rate_threshold,omitempty"` // 0-1, defaults to 0.5
+	OpenDuration          Duration `json:"open_duration,omitempty"`            // time before half-open probing, defaults to 30s
+	HalfOpenRequests      int      `json:"half_open_requests,omitempty"`       // successful probes needed to close, defaults to 1
+}
+
+type Transport struct {
+	DialTimeout           Duration `json:"dial_timeout,omitempty"`            // defaults to 10s
+	TLSHandshakeTimeout   Duration `json:"tls_handshake_timeout,omitempty"`   // defaults to 10s
+	ResponseHeaderTimeout Duration `json:"response_header_timeout,omitempty"` // no limit when unset
+	IdleConnTimeout       Duration `json:"idle_conn_timeout,omitempty"`       // defaults to 90s
+	MaxIdleConnsPerHost   int      `json:"max_idle_conns_per_host,omitempty"` // defaults to 50
+	HTTP2                 *bool    `json:"http2,omitempty"`                   // defaults to true
+}
+
+type Timeouts struct {
+	Connect   Duration `json:"connect,omitempty"`    // tcp connect, overrides transport.dial_timeout
+	FirstByte Duration `json:"first_byte,omitempty"` // from sending the request to the first response body byte
+	Idle      Duration `json:"idle,omitempty"`       // max gap between two stream chunks
+	Total     Duration `json:"total,omitempty"`      // whole request, including failover and streaming
+}
+
+// rate limit keys
+const (
+	RateLimitKeyIP    = "ip"    // client ip
+	RateLimitKeyToken = "token" // gateway api key, or the AUTH_TOKEN_HEADER value
+	RateLimitKeyRoute = "route" // the whole route
+)
+
+// RateLimit is a token bucket over either requests or model tokens. Token
+// limits are charged with the usage of each response, a client over its
+// budget is rejected until the bucket has refilled.
+type RateLimit struct {
+	Requests int      `json:"requests,omitempty"` // requests allowed per Per, or
+	Tokens   int      `json:"tokens,omitempty"`   // prompt + completion tokens allowed per Per
+	Per      Duration `json:"per,omitempty"`      // defaults to 1m
+	Burst    int      `json:"burst,omitempty"`    // bucket size, defaults to Requests or Tokens
+	Key      string   `json:"key,omitempty"`      // ip (default) | token | route
+}
+
+// Quota caps the tokens each client identity may spend on a route, a zero
+// limit means unlimited. Periods roll over at UTC midnight and month start.
+type Quota struct {
+	Daily   int64 `json:"daily,omitempty"`
+	Monthly int64 `json:"monthly,omitempty"`
+}
+
+// Price of a model in USD per million tokens
+type Price struct {
+	Input       float64 `json:"input"`
+	Output      float64 `json:"output"`
+	CachedInput float64 `json:"cached_input,omitempty"` // defaults to Input
+}
+
+// ModelPolicy restricts and rewrites the models a route serves. Patterns are
+// globs like gpt-4o-* or regular expressions prefixed with re:, matched
+// against the whole model name.
+type ModelPolicy struct {
+	Allow   []string           `json:"allow,omitempty"`   // only matching models are served, all when empty
+	Deny    []string           `json:"deny,omitempty"`    // matching models are rejected, checked before allow
+	Rewrite []ModelRewriteRule `json:"rewrite,omitempty"` // applied when model_map has no entry, the first match wins
+}
+
+type ModelRewriteRule struct {
+	Match string `json:"match"` // glob or re: pattern
+	To    string `json:"to"`    // new model, re: patterns may use $1 style groups
+}
+
+// Route protocols, the client's API on the left and the upstream's on the right
+const (
+	ProtocolAnthropicToOpenAI = "anthropic_to_openai" // anthropic /v1/messages -> openai /v1/chat/completions
+	ProtocolOpenAIToGemini    = "openai_to_gemini"    // openai /v1/chat/completions -> gemini generateContent
+	ProtocolResponsesToChat   = "responses_to_chat"   // openai /v1/responses -> openai /v1/chat/completions
+)
+
 type Route struct {
 	Path        string `json:"path"`
 	Target      string `json:"target"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
 
+	// multiple weighted targets (optional), takes precedence over Target
+	Targets     []Target `json:"targets,omitempty"`
+	LoadBalance string   `json:"load_balance,omitempty"` // weighted_round_robin (default) | least_requests | random
+
+	// failover to the next target on connection errors and retryable status codes (optional)
+	Failover *Failover `json:"failover,omitempty"`
+
+	// active health checking of every target (optional)
+	HealthCheck *HealthCheck `json:"health_check,omitempty"`
+
+	// passive circuit breaker driven by error rate and latency (optional)
+	CircuitBreaker *CircuitBreaker `json:"circuit_breaker,omitempty"`
+
+	// upstream connection settings (optional)
+	Transport *Transport `json:"transport,omitempty"`
+
+	// request timeouts, unset values mean no limit (optional)
+	Timeouts *Timeouts `json:"timeouts,omitempty"`
+
+	// token bucket rate limits, all must pass (optional)
+	RateLimits []RateLimit `json:"rate_limits,omitempty"`
+
+	// daily and monthly token budgets per client identity (optional)
+	Quota *Quota `json:"quota,omitempty"`
+
+	// translate between client and upstream APIs, plain proxying when empty (optional)
+	Protocol string `json:"protocol,omitempty"`
+
+	// route-specific prices, override the top-level table (optional)
+	Prices map[string]Price `json:"prices,omitempty"`
+
+	// upstream credential injected instead of the client's own key (optional)
+	Credential *Credential `json:"credential,omitempty"`
+
 	// model mapping (optional)
 	ModelMap map[string]string `json:"model_map,omitempty"`
+
+	// allowed, denied and rewritten models, in the body and in url paths (optional)
+	ModelPolicy *ModelPolicy `json:"model_policy,omitempty"`
+
+	// models served by the route, listed by the model catalog (optional)
+	Models []string `json:"models,omitempty"`
+
+	// upstream model list path like /v1/models, fetched into the catalog when set (optional)
+	ModelsEndpoint string `json:"models_endpoint,omitempty"`
+}
+
+// Upstreams returns the targets of the route, falling back to the single Target
+func (r *Route) Upstreams() []Target {
+	if len(r.Targets) > 0 {
+		return r.Targets
+	}
+	if r.Target == "" {
+		return nil
+	}
+	return []Target{{URL: r.Target, Weight: 1}}
+}
+
+// FailoverEnabled reports whether a failed attempt may be retried against another target
+func (r *Route) FailoverEnabled() bool {
+	return len(r.Upstreams()) > 1 && (r.Failover == nil || !r.Failover.Disabled)
+}
+
+// FailoverMaxAttempts returns the maximum number of targets tried for one request
+func (r *Route) FailoverMaxAttempts() int {
+	n := len(r.Upstreams())
+	if r.Failover != nil && r.Failover.MaxAttempts > 0 && r.Failover.MaxAttempts < n {
+		return r.Failover.MaxAttempts
+	}
+	return n
+}
+
+// ShouldFailover reports whether an upstream status code triggers a retry on the next target
+func (r *Route) ShouldFailover(status int) bool {
+	codes := DefaultFailoverStatusCodes
+	if r.Failover != nil && len(r.Failover.StatusCodes) > 0 {
+		codes = r.Failover.StatusCodes
+	}
+	for _, code := range codes {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
+
+// CredentialFor returns the credential used for one of the route targets
+func (r *Route) CredentialFor(t Target) *Credential {
+	if t.Credential != nil {
+		return t.Credential
+	}
+	return r.Credential
+}
+
+// EffectiveWeight returns the weight used for balancing, a missing weight counts as 1
+func (t Target) EffectiveWeight() int {
+	if t.Weight <= 0 {
+		return 1
+	}
+	return t.Weight
+}
+
+// ModelRouting serves every route from one unified path, the route of a
+// request is picked by the model in its body
+type ModelRouting struct {
+	Path        string      `json:"path"`                    // unified path like /v1
+	StripPrefix bool        `json:"strip_prefix,omitempty"`  // drop Path before forwarding, kept by default so /v1/... reaches upstreams as is
+	Rules       []ModelRule `json:"rules"`                   // tried in order, the first match wins
+	MaxBodySize int64       `json:"max_body_size,omitempty"` // bytes read to find the model, defaults to DefaultModelRoutingMaxBodySize
+}
+
+// DefaultModelRoutingMaxBodySize caps the body read before auth on the unified path
+const DefaultModelRoutingMaxBodySize = 10 << 20
+
+// BodyLimit returns the largest request body read to find the model
+func (mr *ModelRouting) BodyLimit() int64 {
+	if mr.MaxBodySize > 0 {
+		return mr.MaxBodySize
+	}
+	return DefaultModelRoutingMaxBodySize
+}
+
+type ModelRule struct {
+	Model string `json:"model"` // model name or glob like gpt-*
+	Route string `json:"route"` // path of the serving route, like /openai
 }
 
 type RoutesConfig struct {
 	Routes []Route `json:"routes"`
+
+	// unified endpoint dispatching by model (optional)
+	ModelRouting *ModelRouting `json:"model_routing,omitempty"`
+
+	// model price table, keys are model names or globs like gpt-4o* (optional)
+	Prices map[string]Price `json:"prices,omitempty"`
+}
+
+// RouteByPath returns the route with the given path, or nil
+func (c *RoutesConfig) RouteByPath(path string) *Route {
+	for i := range c.Routes {
+		if c.Routes[i].Path == path {
+			return &c.Routes[i]
+		}
+	}
+	return nil
+}
+
+// RouteForModel returns the route the model routing rules send model to, or nil
+func (c *RoutesConfig) RouteForModel(model string) *Route {
+	if c.ModelRouting == nil || model == "" {
+		return nil
+	}
+	for _, rule := range c.ModelRouting.Rules {
+		if util.MatchGlob(rule.Model, model) {
+			return c.RouteByPath(rule.Route)
+		}
+	}
+	return nil
 }
 
 func ResolveRoutesConfigSource() RoutesConfigSource {
@@ -69,31 +351,54 @@ func (s RoutesConfigSource) Description() string {
 	if s.Type == RoutesConfigSourceEnv {
 		return "env var " + s.EnvVar
 	}
+	if isDir(s.Path) {
+		return "directory " + s.Path
+	}
 	return "file " + s.Path
 }
 
+// LoadRoutesConfig loads a routes file, or merges a directory of them
 func LoadRoutesConfig(path string) (*RoutesConfig, error) {
+	if isDir(path) {
+		return LoadRoutesDir(path)
+	}
+
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	return ParseRoutesConfig(data)
+	cfg, err := ParseRoutesConfigFormat(data, DetectFormat(path, data))
+	if err != nil {
+		return nil, inFile(err, path)
+	}
+	return cfg, nil
 }
 
 func LoadRoutesConfigFromSource(source RoutesConfigSource) (*RoutesConfig, error) {
 	if source.Type == RoutesConfigSourceEnv {
-		return ParseRoutesConfig([]byte(source.RawJSON))
+		// already taken from the environment, a ${ in it is kept as written
+		cfg, err := parseRoutesConfig([]byte(source.RawJSON), FormatJSON, false)
+		if err != nil {
+			return nil, inFile(err, source.Description())
+		}
+		return cfg, nil
 	}
 
 	return LoadRoutesConfig(source.Path)
 }
 
-func ParseRoutesConfig(data []byte) (*RoutesConfig, error) {
-	var cfg RoutesConfig
-	if err := json.Unmarshal(data, &cfg); err != nil {
-		return nil, err
+// inFile records which file a FieldError comes from
+func inFile(err error, file string) error {
+	var fe *FieldError
+	if errors.As(err, &fe) {
+		fe.File = file
 	}
+	return err
+}
 
-	return &cfg, nil
+// ParseRoutesConfig decodes a JSON, YAML or TOML routes config, the format
+// is detected from the content
+func ParseRoutesConfig(data []byte) (*RoutesConfig, error) {
+	return ParseRoutesConfigFormat(data, DetectFormat("", data))
 }
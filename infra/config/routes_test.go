@@ -1,6 +1,13 @@
 package config
 
-import "testing"
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestResolveRoutesConfigSourcePrefersJSONEnv(t *testing.T) {
 	t.Setenv(RoutesConfigJSONEnv, `{"routes":[{"name":"OpenAI","path":"/openai","target":"https://api.openai.com"}]}`)
@@ -65,3 +72,315 @@ func TestLoadRoutesConfigFromSourceEnv(t *testing.T) {
 		t.Fatalf("expected /openai, got %q", cfg.Routes[0].Path)
 	}
 }
+
+func TestLoadRoutesConfigFromSourceEnvKeepsReferences(t *testing.T) {
+	source := RoutesConfigSource{
+		Type:    RoutesConfigSourceEnv,
+		EnvVar:  RoutesConfigJSONEnv,
+		RawJSON: `{"routes":[{"name":"OpenAI","path":"/openai","target":"https://api.openai.com","description":"${UNSET_VAR} stays"}]}`,
+	}
+
+	cfg, err := LoadRoutesConfigFromSource(source)
+	if err != nil {
+		t.Fatalf("expected env config with a literal ${ to load, got error: %v", err)
+	}
+	if got := cfg.Routes[0].Description; got != "${UNSET_VAR} stays" {
+		t.Fatalf("expected env config values unchanged, got %q", got)
+	}
+}
+
+func TestRouteForModel(t *testing.T) {
+	cfg, err := ParseRoutesConfig([]byte(`{
+		"routes": [
+			{"name": "OpenAI", "path": "/openai", "target": "https://api.openai.com"},
+			{"name": "Claude", "path": "/claude", "target": "https://api.anthropic.com"}
+		],
+		"model_routing": {
+			"path": "/v1",
+			"rules": [
+				{"model": "gpt-4o-mini", "route": "/claude"},
+				{"model": "gpt-*", "route": "/openai"},
+				{"model": "claude-*", "route": "/claude"}
+			]
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"gpt-4o":            "/openai",
+		"gpt-4o-mini":       "/claude", // first match wins
+		"claude-sonnet-4-5": "/claude",
+		"gemini-2.5-pro":    "",
+		"":                  "",
+	}
+	for model, want := range cases {
+		got := ""
+		if r := cfg.RouteForModel(model); r != nil {
+			got = r.Path
+		}
+		if got != want {
+			t.Errorf("model %q: expected route %q, got %q", model, want, got)
+		}
+	}
+}
+
+func TestParseRoutesConfigFormats(t *testing.T) {
+	t.Setenv("OPENAI_UPSTREAM", "https://eu.api.openai.com")
+	t.Setenv("EMPTY_VAR", "")
+
+	yamlData := []byte(`# generated by deploy tooling
+routes:
+  - name: OpenAI
+    path: /openai
+    target: ${OPENAI_UPSTREAM}
+    description: ${EMPTY_VAR:-primary} route, literal $${HOME}
+    targets:
+      - url: ${OPENAI_UPSTREAM}/
+        weight: 3
+    timeouts:
+      total: 30s
+`)
+	tomlData := []byte(`# generated by deploy tooling
+[[routes]]
+name = "OpenAI"
+path = "/openai"
+target = "${OPENAI_UPSTREAM}"
+description = "${EMPTY_VAR:-primary} route, literal $${HOME}"
+
+[[routes.targets]]
+url = "${OPENAI_UPSTREAM}/"
+weight = 3
+
+[routes.timeouts]
+total = "30s"
+`)
+
+	for name, data := range map[string][]byte{"routes.yaml": yamlData, "routes.toml": tomlData, "routes": yamlData, "routes.conf": tomlData} {
+		cfg, err := LoadRoutesConfig(writeTemp(t, name, data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		r := cfg.Routes[0]
+		if r.Target != "https://eu.api.openai.com" || r.Targets[0].URL != "https://eu.api.openai.com/" || r.Targets[0].Weight != 3 {
+			t.Errorf("%s: targets not expanded: %+v", name, r)
+		}
+		if r.Description != "primary route, literal ${HOME}" {
+			t.Errorf("%s: unexpected description %q", name, r.Description)
+		}
+		if r.Timeouts == nil || r.Timeouts.Total.Std() != 30*time.Second {
+			t.Errorf("%s: unexpected timeouts %+v", name, r.Timeouts)
+		}
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	cases := []struct {
+		path string
+		data string
+		want Format
+	}{
+		{"routes.json", "routes: []", FormatJSON},
+		{"routes.YML", "{}", FormatYAML},
+		{"routes.toml", "{}", FormatTOML},
+		{"", "\n  {\"routes\": []}", FormatJSON},
+		{"", "# comment\n[[routes]]\npath = \"/a\"", FormatTOML},
+		{"", "prices = {}", FormatTOML},
+		{"", "# comment\nroutes:\n  - path: /a", FormatYAML},
+	}
+	for _, c := range cases {
+		if got := DetectFormat(c.path, []byte(c.data)); got != c.want {
+			t.Errorf("DetectFormat(%q, %q) = %s, want %s", c.path, c.data, got, c.want)
+		}
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("SET_VAR", "value")
+	t.Setenv("EMPTY_VAR", "")
+
+	cases := map[string]string{
+		"plain":                "plain",
+		"${SET_VAR}":           "value",
+		"a-${SET_VAR}-b":       "a-value-b",
+		"${UNSET_VAR:-def}":    "def",
+		"${EMPTY_VAR:-def}":    "def",
+		"${EMPTY_VAR}":         "",
+		"${UNSET_VAR:-}":       "",
+		"$${SET_VAR}":          "${SET_VAR}",
+		"${SET_VAR}${SET_VAR}": "valuevalue",
+		"$SET_VAR stays as is": "$SET_VAR stays as is",
+	}
+	for in, want := range cases {
+		got, err := ExpandEnv(in)
+		if err != nil || got != want {
+			t.Errorf("ExpandEnv(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{"${UNSET_VAR}", "${SET_VAR", "${BAD-NAME}"} {
+		if _, err := ExpandEnv(in); err == nil {
+			t.Errorf("ExpandEnv(%q): expected error", in)
+		}
+	}
+}
+
+func TestEscapeEnvRefsRoundTrips(t *testing.T) {
+	t.Setenv("SET_VAR", "value")
+
+	cfg := &RoutesConfig{Routes: []Route{{
+		Path:     "/a",
+		Target:   "https://example.com/?key=${SET_VAR}",
+		Name:     "$${SET_VAR}",
+		ModelMap: map[string]string{"m": "${SET_VAR}"},
+	}}}
+	EscapeEnvRefs(cfg)
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ParseRoutesConfig(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := got.Routes[0]
+	if r.Target != "https://example.com/?key=${SET_VAR}" || r.Name != "$${SET_VAR}" || r.ModelMap["m"] != "${SET_VAR}" {
+		t.Fatalf("expected literal values after reload, got %+v", r)
+	}
+}
+
+func writeTemp(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	writeFile(t, path, string(data))
+	return path
+}
+
+func TestParseRoutesConfigStrict(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			"routes.json",
+			"{\n  \"routes\": [\n    {\"path\": \"/a\", \"target\": \"https://a.example\"},\n    {\"path\": \"/b\",\n     \"taget\": \"https://b.example\"}\n  ]\n}",
+			`routes.json:5:6: routes[1].taget: unknown field, did you mean "target"?`,
+		},
+		{
+			"routes.json",
+			`{"routes": [{"path": "/a", "targets": [{"url": "https://a.example", "weight": "high"}]}]}`,
+			`routes.json:1:69: routes[0].targets[0].weight: expected integer, got string`,
+		},
+		{
+			"routes.json",
+			"{\"routes\": []}\n}",
+			`routes.json:2:1: unexpected data after the top-level object`,
+		},
+		{
+			"routes.yaml",
+			"routes:\n  - path: /a\n    target: https://a.example\n    timeouts:\n      totl: 30s\n",
+			`routes.yaml:5:7: routes[0].timeouts.totl: unknown field, did you mean "total"?`,
+		},
+		{
+			"routes.yaml",
+			"routes:\n  - path: /a\n    model_map:\n      gpt-4.1: [gpt-4o]\n",
+			`routes.yaml:4:7: routes[0].model_map["gpt-4.1"]: expected string, got array`,
+		},
+		{
+			"routes.toml",
+			"[[routes]]\npath = \"/a\"\nprotocl = \"responses_to_chat\"\n",
+			`routes.toml:3:1: routes[0].protocl: unknown field, did you mean "protocol"?`,
+		},
+		{
+			"routes.toml",
+			"[[routes]]\npath = \"/a\nx",
+			`routes.toml:2:11: invalid toml`,
+		},
+	}
+
+	for _, c := range cases {
+		path := writeTemp(t, c.name, []byte(c.data))
+		_, err := LoadRoutesConfig(path)
+		if err == nil {
+			t.Errorf("%s: expected error for %q", c.name, c.data)
+			continue
+		}
+		got := strings.TrimPrefix(err.Error(), filepath.Dir(path)+string(filepath.Separator))
+		if !strings.HasPrefix(got, c.want) {
+			t.Errorf("%s: expected %q, got %q", c.name, c.want, got)
+		}
+	}
+}
+
+func TestLocateSourceFieldError(t *testing.T) {
+	source := RoutesConfigSource{
+		Type:    RoutesConfigSourceEnv,
+		EnvVar:  RoutesConfigJSONEnv,
+		RawJSON: "{\"routes\": [\n  {\"path\": \"/a\", \"target\": \"a.example\"}\n]}",
+	}
+	err := source.Locate(FieldErrorf("routes[0].target", "must be an absolute http(s) url"))
+	if want := "env var ROUTES_CONFIG_JSON:2:18: routes[0].target: must be an absolute http(s) url"; err.Error() != want {
+		t.Fatalf("expected %q, got %q", want, err)
+	}
+}
+
+func TestLoadRoutesDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"10-openai.json":  `{"routes": [{"path": "/openai", "target": "https://api.openai.com"}], "prices": {"gpt-4o": {"input": 2.5, "output": 10}}}`,
+		"20-claude.yaml":  "routes:\n  - path: /claude\n    target: https://api.anthropic.com\nmodel_routing:\n  path: /v1\n  rules:\n    - {model: claude-*, route: /claude}\n",
+		"30-gemini.toml":  "[[routes]]\npath = \"/gemini\"\ntarget = \"https://generativelanguage.googleapis.com\"\n",
+		"notes.txt":       "not a config",
+		".10-openai.json": "{",
+	}
+	for name, data := range files {
+		writeFile(t, filepath.Join(dir, name), data)
+	}
+
+	cfg, err := LoadRoutesConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, r := range cfg.Routes {
+		paths = append(paths, r.Path)
+	}
+	if strings.Join(paths, ",") != "/openai,/claude,/gemini" {
+		t.Fatalf("expected routes in file order, got %v", paths)
+	}
+	if cfg.ModelRouting == nil || cfg.Prices["gpt-4o"].Output != 10 {
+		t.Fatalf("expected model_routing and prices merged, got %+v", cfg)
+	}
+
+	// merged indexes map back to the file and index that define the route
+	source := RoutesConfigSource{Type: RoutesConfigSourceFile, Path: dir}
+	err = source.Locate(FieldErrorf("routes[2].target", "must be an absolute http(s) url"))
+	if want := filepath.Join(dir, "30-gemini.toml") + ":3:1: routes[0].target: must be an absolute http(s) url"; err.Error() != want {
+		t.Fatalf("expected %q, got %q", want, err)
+	}
+
+	writeFile(t, filepath.Join(dir, "40-openai-eu.yaml"), "routes:\n  - path: /gemini\n    target: https://eu.example.com\n  - path: /openai\n    target: https://eu.example.com\nprices:\n  gpt-4o: {input: 1, output: 1}\n")
+	_, err = LoadRoutesConfig(dir)
+	if err == nil {
+		t.Fatal("expected conflicts")
+	}
+	for _, want := range []string{
+		"40-openai-eu.yaml:2:5: routes[0].path: path '/gemini' is also defined in " + filepath.Join(dir, "30-gemini.toml"),
+		"40-openai-eu.yaml:4:5: routes[1].path: path '/openai' is also defined in " + filepath.Join(dir, "10-openai.json"),
+		"40-openai-eu.yaml:7:3: prices[\"gpt-4o\"]: price is also defined in",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected conflict %q in %q", want, err)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,206 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// FieldError is a config problem at a field path like routes[2].targets[0].url.
+// File, Line and Column are filled in when the source is known.
+type FieldError struct {
+	File   string
+	Line   int
+	Column int
+	Path   string
+	Msg    string
+}
+
+func (e *FieldError) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		b.WriteString(e.File)
+		if e.Line > 0 {
+			fmt.Fprintf(&b, ":%d:%d", e.Line, e.Column)
+		}
+		b.WriteString(": ")
+	}
+	if e.Path != "" {
+		b.WriteString(e.Path)
+		b.WriteString(": ")
+	}
+	b.WriteString(e.Msg)
+	return b.String()
+}
+
+// FieldErrorf returns a FieldError at path
+func FieldErrorf(path, format string, args ...any) *FieldError {
+	return &FieldError{Path: path, Msg: fmt.Sprintf(format, args...)}
+}
+
+// JoinPath appends a struct field, a slice index or a map key to a field path
+func JoinPath(path string, elem any) string {
+	switch e := elem.(type) {
+	case int:
+		return path + "[" + strconv.Itoa(e) + "]"
+	case string:
+		if path == "" {
+			return e
+		}
+		return path + "." + e
+	}
+	return path
+}
+
+// MapKeyPath appends a map key to a field path, quoted as it may contain dots
+func MapKeyPath(path, key string) string {
+	return path + "[" + strconv.Quote(key) + "]"
+}
+
+var jsonUnmarshaler = reflect.TypeFor[json.Unmarshaler]()
+
+// checkTree walks a decoded config against the type it will be decoded into,
+// so unknown fields and mistyped values are reported with their path
+func checkTree(v any, t reflect.Type, path string) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if v == nil || reflect.PointerTo(t).Implements(jsonUnmarshaler) {
+		return checkLeaf(v, t, path)
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := v.(map[string]any)
+		if !ok {
+			break
+		}
+		fields := jsonFields(t)
+		for _, k := range sortedKeys(m) {
+			f, ok := fields[k]
+			if !ok {
+				return FieldErrorf(JoinPath(path, k), "unknown field%s", suggest(k, fields))
+			}
+			if err := checkTree(m[k], f.Type, JoinPath(path, k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Slice:
+		s, ok := v.([]any)
+		if !ok {
+			break
+		}
+		for i, item := range s {
+			if err := checkTree(item, t.Elem(), JoinPath(path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		m, ok := v.(map[string]any)
+		if !ok {
+			break
+		}
+		for _, k := range sortedKeys(m) {
+			if err := checkTree(m[k], t.Elem(), MapKeyPath(path, k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return checkLeaf(v, t, path)
+}
+
+// checkLeaf decodes a single value to surface type errors at its own path
+func checkLeaf(v any, t reflect.Type, path string) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return FieldErrorf(path, "%v", err)
+	}
+	if err := json.Unmarshal(data, reflect.New(t).Interface()); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return FieldErrorf(path, "expected %s, got %s", typeName(t), typeErr.Value)
+		}
+		return FieldErrorf(path, "%s", strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return nil
+}
+
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		return "object"
+	case reflect.Slice:
+		return "list"
+	case reflect.Int, reflect.Int64:
+		return "integer"
+	case reflect.Float64:
+		return "number"
+	}
+	return t.Kind().String()
+}
+
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// suggest names the known field closest to a misspelled one
+func suggest(name string, fields map[string]reflect.StructField) string {
+	best, bestDist := "", 3
+	for known := range fields {
+		if d := editDistance(name, known); d < bestDist || d == bestDist && best != "" && known < best {
+			best, bestDist = known, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %q?", best)
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
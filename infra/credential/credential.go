@@ -0,0 +1,114 @@
+package credential
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/poixeai/proxify/infra/config"
+)
+
+// client-side key headers, removed whenever the gateway injects its own credential
+var clientKeyHeaders = []string{
+	"Authorization",
+	"X-Api-Key",
+	"Api-Key",
+	"X-Goog-Api-Key",
+}
+
+// Resolve reads the key of a credential from its env var or file
+func Resolve(cred *config.Credential) (string, error) {
+	switch {
+	case cred.Env != "":
+		key := strings.TrimSpace(os.Getenv(cred.Env))
+		if key == "" {
+			return "", fmt.Errorf("credential env var %s is empty", cred.Env)
+		}
+		return key, nil
+	case cred.File != "":
+		return readFile(cred.File)
+	default:
+		return "", fmt.Errorf("credential has neither env nor file")
+	}
+}
+
+// Apply strips every client key from the request and injects the upstream
+// credential in the header its provider expects. gatewayHeader is the header
+// the client used to authenticate with the gateway itself, it is never
+// forwarded upstream.
+func Apply(req *http.Request, cred *config.Credential, gatewayHeader string) error {
+	key, err := Resolve(cred)
+	if err != nil {
+		return err
+	}
+
+	for _, h := range clientKeyHeaders {
+		req.Header.Del(h)
+	}
+	if gatewayHeader != "" {
+		req.Header.Del(gatewayHeader)
+	}
+
+	switch cred.Type {
+	case config.CredentialTypeAnthropic:
+		req.Header.Set("x-api-key", key)
+	case config.CredentialTypeAzure:
+		req.Header.Set("api-key", key)
+	case config.CredentialTypeGemini:
+		req.Header.Set("x-goog-api-key", key)
+
+		// gemini clients may also pass their key as ?key=
+		q := req.URL.Query()
+		if q.Has("key") {
+			q.Del("key")
+			req.URL.RawQuery = q.Encode()
+		}
+	default:
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	return nil
+}
+
+/* --------------------- File Cache ---------------------- */
+
+type cachedFile struct {
+	modTime time.Time
+	key     string
+}
+
+var (
+	fileMu    sync.Mutex
+	fileCache = make(map[string]cachedFile)
+)
+
+// readFile returns the trimmed content of a secret file, re-reading it only
+// when it changed on disk so rotated secrets are picked up without a restart
+func readFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("credential file: %w", err)
+	}
+
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	if cached, ok := fileCache[path]; ok && cached.modTime.Equal(info.ModTime()) {
+		return cached.key, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("credential file: %w", err)
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", fmt.Errorf("credential file %s is empty", path)
+	}
+
+	fileCache[path] = cachedFile{modTime: info.ModTime(), key: key}
+	return key, nil
+}
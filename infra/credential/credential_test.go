@@ -0,0 +1,56 @@
+package credential
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/poixeai/proxify/infra/config"
+)
+
+func TestApplyGeminiStripsQueryKey(t *testing.T) {
+	t.Setenv("TEST_GEMINI_KEY", "gemini-upstream")
+
+	req, _ := http.NewRequest(http.MethodPost, "https://generativelanguage.googleapis.com/v1beta/models/gemini-2.0-flash:generateContent?key=client&alt=sse", nil)
+	req.Header.Set("x-goog-api-key", "client")
+
+	if err := Apply(req, &config.Credential{Type: config.CredentialTypeGemini, Env: "TEST_GEMINI_KEY"}, ""); err != nil {
+		t.Fatalf("expected credential to apply, got error: %v", err)
+	}
+	if got := req.Header.Get("x-goog-api-key"); got != "gemini-upstream" {
+		t.Fatalf("expected injected key, got %q", got)
+	}
+	if got := req.URL.RawQuery; got != "alt=sse" {
+		t.Fatalf("expected key query param to be removed, got %q", got)
+	}
+}
+
+func TestResolveFilePicksUpRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "openai_key")
+	if err := os.WriteFile(path, []byte("sk-first\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cred := &config.Credential{File: path}
+	if key, err := Resolve(cred); err != nil || key != "sk-first" {
+		t.Fatalf("expected first key, got %q (%v)", key, err)
+	}
+
+	if err := os.WriteFile(path, []byte("sk-second"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	if key, err := Resolve(cred); err != nil || key != "sk-second" {
+		t.Fatalf("expected rotated key, got %q (%v)", key, err)
+	}
+
+	if _, err := Resolve(&config.Credential{Env: "TEST_UNSET_KEY_ENV"}); err == nil {
+		t.Fatal("expected empty env var to be an error")
+	}
+}
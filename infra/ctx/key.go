@@ -10,4 +10,12 @@ const (
 	TargetURL        = "target_url"          // like https://api.openai.com/v1/chat/completions
 	Proxified        = "proxified"           // bool, whether the request has been proxified
 	RouteConfig      = "route_config"
+	Upstream         = "upstream"      // *balancer.Selection, the target chosen for this request
+	APIKeyName       = "api_key_name"  // name of the gateway api key used by the client
+	APIKeyOwner      = "api_key_owner" // owner of the gateway api key used by the client
+	Usage            = "usage"         // *usage.Usage, tokens reported by the upstream response
+	Cost             = "cost"          // float64, USD cost of the usage, unset when the model has no price
+	Streaming        = "streaming"     // bool, whether the upstream response is streamed
+	ModelList        = "model_list"    // bool, whether the request is GET <model_routing.path>/models
+	RequestModel     = "request_model" // model sent upstream, set where the request body or path is parsed
 )
@@ -0,0 +1,255 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/poixeai/proxify/infra/config"
+	"github.com/poixeai/proxify/infra/credential"
+	"github.com/poixeai/proxify/infra/logger"
+	"github.com/poixeai/proxify/infra/transport"
+	"github.com/poixeai/proxify/util"
+)
+
+const (
+	defaultInterval           = 30 * time.Second
+	defaultTimeout            = 5 * time.Second
+	defaultExpectedStatus     = http.StatusOK
+	defaultUnhealthyThreshold = 3
+	defaultHealthyThreshold   = 2
+
+	// how often the checker looks for due probes
+	tickInterval = time.Second
+)
+
+// Status is the health state of one route target
+type Status struct {
+	Route                string    `json:"route"`
+	Target               string    `json:"target"`
+	Healthy              bool      `json:"healthy"`
+	ConsecutiveFailures  int       `json:"consecutive_failures"`
+	ConsecutiveSuccesses int       `json:"consecutive_successes"`
+	LastCheck            time.Time `json:"last_check,omitempty"`
+	LastStatus           int       `json:"last_status,omitempty"`
+	LastLatencyMs        int64     `json:"last_latency_ms,omitempty"`
+	LastError            string    `json:"last_error,omitempty"`
+
+	probing bool
+}
+
+var (
+	mu     sync.RWMutex
+	states = make(map[string]*Status) // route path + target url -> status
+
+	startOnce sync.Once
+)
+
+// RoutesFunc returns the current routes config
+type RoutesFunc func() *config.RoutesConfig
+
+// Start runs the background health checker, probing targets of every route
+// that has a health_check block. Calling it more than once has no effect.
+func Start(routes RoutesFunc) {
+	startOnce.Do(func() {
+		go run(routes)
+		logger.Infof("[Health] upstream health checker started")
+	})
+}
+
+func run(routes RoutesFunc) {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	for {
+		checkDue(routes(), time.Now())
+		<-ticker.C
+	}
+}
+
+// checkDue starts probes for every target whose interval has elapsed and
+// forgets targets that are no longer configured
+func checkDue(cfg *config.RoutesConfig, now time.Time) {
+	active := make(map[string]bool)
+
+	for i := range cfg.Routes {
+		r := &cfg.Routes[i]
+		if r.HealthCheck == nil {
+			continue
+		}
+		hc := *r.HealthCheck
+
+		for _, t := range r.Upstreams() {
+			k := key(r.Path, t.URL)
+			active[k] = true
+
+			mu.Lock()
+			st, ok := states[k]
+			if !ok {
+				// targets start healthy until proven otherwise
+				st = &Status{Route: r.Path, Target: util.RedactURL(t.URL), Healthy: true}
+				states[k] = st
+			}
+			due := !st.probing && now.Sub(st.LastCheck) >= hc.Interval.Or(defaultInterval)
+			if due {
+				st.probing = true
+			}
+			mu.Unlock()
+
+			if due {
+				go probe(k, r, t, hc)
+			}
+		}
+	}
+
+	mu.Lock()
+	for k := range states {
+		if !active[k] {
+			delete(states, k)
+		}
+	}
+	mu.Unlock()
+}
+
+func probe(k string, route *config.Route, t config.Target, hc config.HealthCheck) {
+	timeout := hc.Timeout.Or(defaultTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	status, err := doProbe(ctx, transport.Client(route), util.JoinURL(t.URL, hc.Path), route.CredentialFor(t))
+	latency := time.Since(start)
+
+	expected := hc.ExpectedStatus
+	if expected == 0 {
+		expected = defaultExpectedStatus
+	}
+	ok := err == nil && status == expected
+
+	record(k, hc, ok, status, latency, err)
+}
+
+// doProbe sends one probe through the route's own client, so connect
+// timeouts and proxies match real traffic
+func doProbe(ctx context.Context, client *http.Client, target string, cred *config.Credential) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "proxify-health-check")
+
+	// most provider endpoints need a key, probe with the upstream credential when there is one
+	if cred != nil {
+		if err := credential.Apply(req, cred, ""); err != nil {
+			return 0, err
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// the error names the target, which the public status must not leak
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			ue.URL = util.RedactURL(ue.URL)
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	return resp.StatusCode, nil
+}
+
+func record(k string, hc config.HealthCheck, ok bool, status int, latency time.Duration, err error) {
+	unhealthyThreshold := hc.UnhealthyThreshold
+	if unhealthyThreshold <= 0 {
+		unhealthyThreshold = defaultUnhealthyThreshold
+	}
+	healthyThreshold := hc.HealthyThreshold
+	if healthyThreshold <= 0 {
+		healthyThreshold = defaultHealthyThreshold
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	st, exists := states[k]
+	if !exists {
+		// target removed while probing
+		return
+	}
+
+	st.probing = false
+	st.LastCheck = time.Now()
+	st.LastStatus = status
+	st.LastLatencyMs = latency.Milliseconds()
+	st.LastError = ""
+	if err != nil {
+		st.LastError = err.Error()
+	}
+
+	if ok {
+		st.ConsecutiveSuccesses++
+		st.ConsecutiveFailures = 0
+		if !st.Healthy && st.ConsecutiveSuccesses >= healthyThreshold {
+			st.Healthy = true
+			logger.Infof("[Health] route=%s target=%s is healthy again", st.Route, st.Target)
+		}
+		return
+	}
+
+	st.ConsecutiveFailures++
+	st.ConsecutiveSuccesses = 0
+	if st.Healthy && st.ConsecutiveFailures >= unhealthyThreshold {
+		st.Healthy = false
+		logger.Warnf("[Health] route=%s target=%s marked unhealthy after %d failures (status=%d, err=%v)",
+			st.Route, st.Target, st.ConsecutiveFailures, status, err)
+	}
+}
+
+// IsHealthy reports whether a target of the route may receive traffic.
+// Targets without health checking are always healthy.
+func IsHealthy(route *config.Route, target string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	st, ok := states[key(route.Path, target)]
+	return !ok || st.Healthy
+}
+
+// Available returns a target filter for the balancer
+func Available(route *config.Route) func(config.Target) bool {
+	if route.HealthCheck == nil {
+		return nil
+	}
+	return func(t config.Target) bool {
+		return IsHealthy(route, t.URL)
+	}
+}
+
+// Snapshot returns the health state of every checked target, sorted by route and target
+func Snapshot() []Status {
+	mu.RLock()
+	list := make([]Status, 0, len(states))
+	for _, st := range states {
+		list = append(list, *st)
+	}
+	mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Route != list[j].Route {
+			return list[i].Route < list[j].Route
+		}
+		return list[i].Target < list[j].Target
+	})
+	return list
+}
+
+func key(route, target string) string {
+	return route + "|" + target
+}
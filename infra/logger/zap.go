@@ -24,8 +24,8 @@ type LoggerConfig struct {
 	LogFileName string // log file name
 }
 
-// global logger
-var ZapLog *zap.SugaredLogger
+// global logger, discards everything until Init is called
+var ZapLog = zap.NewNop().Sugar()
 
 // Init initializes the global logger
 func Init(config *LoggerConfig) {
@@ -0,0 +1,247 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A minimal Prometheus text exposition (format 0.0.4) implementation.
+// Metrics register themselves on creation and are written by WriteText.
+
+type collector interface {
+	write(w io.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []collector
+)
+
+func register(c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, c)
+}
+
+// WriteText writes every registered metric in Prometheus text format
+func WriteText(w io.Writer) {
+	registryMu.Lock()
+	list := append([]collector(nil), registry...)
+	registryMu.Unlock()
+
+	for _, c := range list {
+		c.write(w)
+	}
+}
+
+/* --------------------- Series ---------------------- */
+
+// vec holds one series per label value combination
+type vec[T any] struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*T
+	values map[string][]string
+}
+
+func newVec[T any](name, help, typ string, labels []string) *vec[T] {
+	return &vec[T]{
+		name:   name,
+		help:   help,
+		typ:    typ,
+		labels: labels,
+		series: make(map[string]*T),
+		values: make(map[string][]string),
+	}
+}
+
+// with runs fn on the series of the label values, creating it with init. It
+// panics on a label count mismatch, which is a programming error.
+func (v *vec[T]) with(values []string, init func() *T, fn func(*T)) {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	s, ok := v.series[key]
+	if !ok {
+		s = init()
+		v.series[key] = s
+		v.values[key] = append([]string(nil), values...)
+	}
+	fn(s)
+}
+
+// each calls fn for every series in label order, holding the lock
+func (v *vec[T]) each(w io.Writer, fn func(values []string, s *T)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.typ)
+
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fn(v.values[k], v.series[k])
+	}
+}
+
+func formatLabels(names, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, n, escape(values[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, extra[i], escape(extra[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+/* --------------------- Counter ---------------------- */
+
+// CounterVec is a monotonically increasing value per label set
+type CounterVec struct {
+	*vec[float64]
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec[float64](name, help, "counter", labels)}
+	register(c)
+	return c
+}
+
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *CounterVec) Add(delta float64, values ...string) {
+	c.with(values, func() *float64 { return new(float64) }, func(v *float64) { *v += delta })
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.each(w, func(values []string, v *float64) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, values), formatFloat(*v))
+	})
+}
+
+/* --------------------- Gauge ---------------------- */
+
+// GaugeVec is a value that can go up and down per label set
+type GaugeVec struct {
+	*vec[float64]
+}
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newVec[float64](name, help, "gauge", labels)}
+	register(g)
+	return g
+}
+
+func (g *GaugeVec) Set(value float64, values ...string) {
+	g.with(values, func() *float64 { return new(float64) }, func(v *float64) { *v = value })
+}
+
+func (g *GaugeVec) Add(delta float64, values ...string) {
+	g.with(values, func() *float64 { return new(float64) }, func(v *float64) { *v += delta })
+}
+
+func (g *GaugeVec) Inc(values ...string) { g.Add(1, values...) }
+func (g *GaugeVec) Dec(values ...string) { g.Add(-1, values...) }
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.each(w, func(values []string, v *float64) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels(g.labels, values), formatFloat(*v))
+	})
+}
+
+/* --------------------- Histogram ---------------------- */
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// HistogramVec counts observations into fixed buckets per label set
+type HistogramVec struct {
+	*vec[histogram]
+	buckets []float64
+}
+
+// NewHistogramVec creates a histogram, buckets are upper bounds in increasing order
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{newVec[histogram](name, help, "histogram", labels), buckets}
+	register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	h.with(values, func() *histogram {
+		return &histogram{counts: make([]uint64, len(h.buckets))}
+	}, func(s *histogram) {
+		if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+			s.counts[i]++
+		}
+		s.sum += value
+		s.count++
+	})
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.each(w, func(values []string, s *histogram) {
+		var cumulative uint64
+		for i, b := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, values, "le", formatFloat(b)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, values, "le", "+Inf"), s.count)
+
+		labels := formatLabels(h.labels, values)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labels, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labels, s.count)
+	})
+}
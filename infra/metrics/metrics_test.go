@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteTextFormatsSeries(t *testing.T) {
+	registryMu.Lock()
+	saved := registry
+	registry = nil
+	registryMu.Unlock()
+	defer func() {
+		registryMu.Lock()
+		registry = saved
+		registryMu.Unlock()
+	}()
+
+	requests := NewCounterVec("test_requests_total", "Requests.", "route", "status")
+	requests.Inc("/openai", "200")
+	requests.Add(2, "/openai", "200")
+	requests.Inc(`/we"ird`, "500")
+
+	active := NewGaugeVec("test_active", "Active.")
+	active.Inc()
+	active.Inc()
+	active.Dec()
+
+	latency := NewHistogramVec("test_latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	latency.Observe(0.05, "/openai")
+	latency.Observe(0.5, "/openai")
+	latency.Observe(5, "/openai")
+
+	var buf bytes.Buffer
+	WriteText(&buf)
+	out := buf.String()
+
+	for _, want := range []string{
+		"# TYPE test_requests_total counter\n",
+		`test_requests_total{route="/openai",status="200"} 3` + "\n",
+		`test_requests_total{route="/we\"ird",status="500"} 1` + "\n",
+		"# TYPE test_active gauge\ntest_active 1\n",
+		"# TYPE test_latency_seconds histogram\n",
+		`test_latency_seconds_bucket{route="/openai",le="0.1"} 1` + "\n",
+		`test_latency_seconds_bucket{route="/openai",le="1"} 2` + "\n",
+		`test_latency_seconds_bucket{route="/openai",le="+Inf"} 3` + "\n",
+		`test_latency_seconds_sum{route="/openai"} 5.55` + "\n",
+		`test_latency_seconds_count{route="/openai"} 3` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestMethodLabel(t *testing.T) {
+	for method, want := range map[string]string{
+		"GET":      "GET",
+		"OPTIONS":  "OPTIONS",
+		"get":      "other",
+		"PROPFIND": "other",
+		"":         "other",
+	} {
+		if got := MethodLabel(method); got != want {
+			t.Errorf("MethodLabel(%q) = %q, want %q", method, got, want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import "net/http"
+
+var (
+	latencyBuckets  = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+	durationBuckets = []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+	ratioBuckets    = []float64{0.05, 0.1, 0.2, 0.3, 0.5, 0.7, 0.9, 1}
+)
+
+// requests
+var (
+	Requests = NewCounterVec(
+		"proxify_requests_total",
+		"Requests handled, by route, status code and method.",
+		"route", "status", "method",
+	)
+	AuthRejections = NewCounterVec(
+		"proxify_auth_rejections_total",
+		"Requests rejected by authentication, by reason.",
+		"reason",
+	)
+)
+
+// MethodLabel bounds the method label to the standard HTTP methods, the
+// request method is client controlled and would grow a series per value
+func MethodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return method
+	default:
+		return "other"
+	}
+}
+
+// upstream
+var (
+	UpstreamLatency = NewHistogramVec(
+		"proxify_upstream_latency_seconds",
+		"Time until an upstream attempt returned response headers, by route and outcome.",
+		latencyBuckets,
+		"route", "outcome",
+	)
+	TimeToFirstByte = NewHistogramVec(
+		"proxify_time_to_first_byte_seconds",
+		"Time from receiving a request to the first upstream body byte, by route.",
+		latencyBuckets,
+		"route",
+	)
+	StreamDuration = NewHistogramVec(
+		"proxify_stream_duration_seconds",
+		"Duration of streamed responses from headers to the last byte, by route.",
+		durationBuckets,
+		"route",
+	)
+	ActiveStreams = NewGaugeVec(
+		"proxify_active_streams",
+		"Streamed responses currently in flight, by route.",
+		"route",
+	)
+)
+
+// stream smoothing
+var (
+	SmoothingBufferOccupancy = NewHistogramVec(
+		"proxify_smoothing_buffer_occupancy_ratio",
+		"Fill ratio of the smoothing buffer, sampled at every rate adjustment.",
+		ratioBuckets,
+	)
+	SmoothingTailDrain = NewHistogramVec(
+		"proxify_smoothing_tail_drain_seconds",
+		"Time spent flushing buffered chunks after the upstream finished.",
+		latencyBuckets,
+	)
+	SmoothingIntervalAdjustments = NewCounterVec(
+		"proxify_smoothing_interval_adjustments_total",
+		"Send interval changes of the smoothing layer, by reason (adjust, sprint, tail).",
+		"reason",
+	)
+)
+
+// config
+var (
+	ConfigReloads = NewCounterVec(
+		"proxify_config_reloads_total",
+		"Routes config hot reloads, by result (success, failure).",
+		"result",
+	)
+)
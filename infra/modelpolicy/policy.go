@@ -0,0 +1,183 @@
+package modelpolicy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/poixeai/proxify/infra/config"
+	"github.com/poixeai/proxify/util"
+)
+
+// prefix marking a pattern as a regular expression
+const regexPrefix = "re:"
+
+type matcher struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+func (m matcher) match(model string) bool {
+	if m.re != nil {
+		return m.re.MatchString(model)
+	}
+	return util.MatchGlob(m.glob, model)
+}
+
+type rewriteRule struct {
+	matcher
+	to string
+}
+
+// Policy is a compiled route model policy
+type Policy struct {
+	modelMap map[string]string
+	allow    []matcher
+	deny     []matcher
+	rewrite  []rewriteRule
+}
+
+func compilePattern(p string) (matcher, error) {
+	if expr, ok := strings.CutPrefix(p, regexPrefix); ok {
+		// anchored, patterns match the whole model name like globs do
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return matcher{}, fmt.Errorf("invalid pattern '%s': %w", p, err)
+		}
+		return matcher{re: re}, nil
+	}
+	if p == "" {
+		return matcher{}, fmt.Errorf("empty pattern")
+	}
+	return matcher{glob: p}, nil
+}
+
+// Compile checks the patterns of a route and compiles them
+func Compile(route *config.Route) (*Policy, error) {
+	p := &Policy{modelMap: route.ModelMap}
+
+	mp := route.ModelPolicy
+	if mp == nil {
+		return p, nil
+	}
+
+	for _, pattern := range mp.Allow {
+		m, err := compilePattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("allow: %w", err)
+		}
+		p.allow = append(p.allow, m)
+	}
+	for _, pattern := range mp.Deny {
+		m, err := compilePattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("deny: %w", err)
+		}
+		p.deny = append(p.deny, m)
+	}
+	for i, rule := range mp.Rewrite {
+		m, err := compilePattern(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("rewrite[%d]: %w", i, err)
+		}
+		if rule.To == "" {
+			return nil, fmt.Errorf("rewrite[%d]: empty target model", i)
+		}
+		p.rewrite = append(p.rewrite, rewriteRule{matcher: m, to: rule.To})
+	}
+	return p, nil
+}
+
+// Allowed reports whether the route serves the model the client asked for
+func (p *Policy) Allowed(model string) bool {
+	for _, m := range p.deny {
+		if m.match(model) {
+			return false
+		}
+	}
+	if len(p.allow) == 0 {
+		return true
+	}
+	for _, m := range p.allow {
+		if m.match(model) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rewrite returns the model sent upstream, model_map first, then the rewrite rules
+func (p *Policy) Rewrite(model string) string {
+	if to, ok := p.modelMap[model]; ok && to != "" {
+		return to
+	}
+	for _, r := range p.rewrite {
+		if !r.match(model) {
+			continue
+		}
+		if r.re != nil {
+			return r.re.ReplaceAllString(model, r.to)
+		}
+		return r.to
+	}
+	return model
+}
+
+/* --------------------- Registry ---------------------- */
+
+type entry struct {
+	source *config.ModelPolicy
+	policy *Policy
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]entry) // route path -> compiled policy
+)
+
+// For returns the compiled policy of a route, recompiled after a hot reload.
+// Routes are validated on load, so a compile error only leaves the policy empty.
+func For(route *config.Route) *Policy {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if e, ok := registry[route.Path]; ok && e.source == route.ModelPolicy && e.policy.sameMap(route.ModelMap) {
+		return e.policy
+	}
+
+	p, err := Compile(route)
+	if err != nil {
+		p = &Policy{modelMap: route.ModelMap}
+	}
+	registry[route.Path] = entry{source: route.ModelPolicy, policy: p}
+	return p
+}
+
+func (p *Policy) sameMap(m map[string]string) bool {
+	if len(p.modelMap) != len(m) {
+		return false
+	}
+	for k, v := range m {
+		if p.modelMap[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+/* --------------------- URL Paths ---------------------- */
+
+// path segments naming a model, gemini /models/{model}:generateContent and
+// azure /deployments/{name}/chat/completions
+var pathModel = regexp.MustCompile(`/(models|deployments)/([^/:?]+)`)
+
+// PathModel returns the model named in a url path and its byte range
+func PathModel(path string) (string, int, int) {
+	p, _, _ := strings.Cut(path, "?")
+	loc := pathModel.FindStringSubmatchIndex(p)
+	if loc == nil {
+		return "", -1, -1
+	}
+	return p[loc[4]:loc[5]], loc[4], loc[5]
+}
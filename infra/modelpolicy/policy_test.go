@@ -0,0 +1,81 @@
+package modelpolicy
+
+import (
+	"testing"
+
+	"github.com/poixeai/proxify/infra/config"
+)
+
+func TestPolicyAllowAndDeny(t *testing.T) {
+	p, err := Compile(&config.Route{ModelPolicy: &config.ModelPolicy{
+		Allow: []string{"gpt-4o*", `re:o[134](-mini)?`},
+		Deny:  []string{"gpt-4o-audio-*"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]bool{
+		"gpt-4o":                 true,
+		"gpt-4o-mini":            true,
+		"o3":                     true,
+		"o4-mini":                true,
+		"o3-pro":                 false, // regexes match the whole name
+		"gpt-4o-audio-preview":   false,
+		"gpt-3.5-turbo":          false,
+		"claude-sonnet-4-5-x-o3": false,
+	}
+	for model, want := range cases {
+		if got := p.Allowed(model); got != want {
+			t.Errorf("model %q: expected allowed=%v, got %v", model, want, got)
+		}
+	}
+}
+
+func TestPolicyRewrite(t *testing.T) {
+	p, err := Compile(&config.Route{
+		ModelMap: map[string]string{"gpt-4o-2024-05-13": "gpt-4o"},
+		ModelPolicy: &config.ModelPolicy{Rewrite: []config.ModelRewriteRule{
+			{Match: "gpt-4o-*", To: "gpt-4o-mini"},
+			{Match: `re:claude-(\w+)-latest`, To: "claude-$1-4-5"},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"gpt-4o-2024-05-13":    "gpt-4o", // model_map first
+		"gpt-4o-2024-08-06":    "gpt-4o-mini",
+		"claude-sonnet-latest": "claude-sonnet-4-5",
+		"gemini-2.5-pro":       "gemini-2.5-pro",
+	}
+	for model, want := range cases {
+		if got := p.Rewrite(model); got != want {
+			t.Errorf("model %q: expected %q, got %q", model, want, got)
+		}
+	}
+
+	if _, err := Compile(&config.Route{ModelPolicy: &config.ModelPolicy{Deny: []string{"re:("}}}); err == nil {
+		t.Fatal("expected invalid regex to fail")
+	}
+}
+
+func TestPathModel(t *testing.T) {
+	cases := map[string]string{
+		"/v1beta/models/gemini-2.5-pro:streamGenerateContent?alt=sse": "gemini-2.5-pro",
+		"/openai/deployments/gpt-4o/chat/completions?api-version=1":   "gpt-4o",
+		"/v1/models/gpt-4o":    "gpt-4o",
+		"/v1/models":           "",
+		"/v1/chat/completions": "",
+	}
+	for path, want := range cases {
+		model, start, end := PathModel(path)
+		if model != want {
+			t.Errorf("path %q: expected %q, got %q", path, want, model)
+		}
+		if model != "" && path[start:end] != model {
+			t.Errorf("path %q: wrong range %d-%d", path, start, end)
+		}
+	}
+}
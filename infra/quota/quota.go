@@ -0,0 +1,272 @@
+package quota
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/poixeai/proxify/infra/config"
+	"github.com/poixeai/proxify/infra/logger"
+	"github.com/poixeai/proxify/infra/store"
+)
+
+const (
+	StorePathEnv     = "QUOTA_STORE_PATH"
+	DefaultStorePath = "data/quota.json"
+
+	// how often dirty counters are written to disk
+	flushInterval = 5 * time.Second
+)
+
+// Counter is the token spend of one client identity on one route
+type Counter struct {
+	Route     string `json:"route"`
+	Identity  string `json:"identity"`
+	Day       string `json:"day"` // 2006-01-02, UTC
+	DayUsed   int64  `json:"day_used"`
+	Month     string `json:"month"` // 2006-01, UTC
+	MonthUsed int64  `json:"month_used"`
+}
+
+// Status is the budget of one counter against the route's current quota,
+// remaining values are omitted for unlimited periods
+type Status struct {
+	Route            string    `json:"route"`
+	Identity         string    `json:"identity"`
+	DailyLimit       int64     `json:"daily_limit,omitempty"`
+	DailyUsed        int64     `json:"daily_used"`
+	DailyRemaining   *int64    `json:"daily_remaining,omitempty"`
+	DailyResetAt     time.Time `json:"daily_reset_at"`
+	MonthlyLimit     int64     `json:"monthly_limit,omitempty"`
+	MonthlyUsed      int64     `json:"monthly_used"`
+	MonthlyRemaining *int64    `json:"monthly_remaining,omitempty"`
+	MonthlyResetAt   time.Time `json:"monthly_reset_at"`
+}
+
+type file struct {
+	Counters []*Counter `json:"counters"`
+}
+
+var (
+	mu       sync.Mutex
+	counters = make(map[string]*Counter) // route path + identity -> counter
+	dirty    bool
+	path     string // empty keeps counters in memory only
+
+	// serializes flushes from the snapshot to the rename, so an older
+	// snapshot never replaces a newer one on disk
+	flushMu sync.Mutex
+
+	openOnce sync.Once
+)
+
+// Open loads the persisted counters from path and keeps writing them back
+// in the background. Without Open, counters live in memory only.
+func Open(p string) error {
+	var f file
+	if err := store.ReadJSON(p, &f); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	path = p
+	for _, ct := range f.Counters {
+		counters[key(ct.Route, ct.Identity)] = ct
+	}
+	mu.Unlock()
+
+	openOnce.Do(func() {
+		go func() {
+			for range time.Tick(flushInterval) {
+				if err := Flush(); err != nil {
+					logger.Errorf("[Quota] failed to persist counters: %v", err)
+				}
+			}
+		}()
+	})
+
+	logger.Infof("[Quota] counters loaded from %s, entries=%d", p, len(f.Counters))
+	return nil
+}
+
+// Flush drops counters of past months and writes the rest to disk when they
+// changed since the last flush
+func Flush() error {
+	flushMu.Lock()
+	defer flushMu.Unlock()
+
+	month := time.Now().UTC().Format("2006-01")
+
+	mu.Lock()
+	if path == "" || !dirty {
+		mu.Unlock()
+		return nil
+	}
+	f := file{Counters: make([]*Counter, 0, len(counters))}
+	for k, ct := range counters {
+		// both periods are over, the counter would only be reset
+		if ct.Month != month {
+			delete(counters, k)
+			continue
+		}
+		cp := *ct
+		f.Counters = append(f.Counters, &cp)
+	}
+	p := path
+	dirty = false
+	mu.Unlock()
+
+	sort.Slice(f.Counters, func(i, j int) bool {
+		return key(f.Counters[i].Route, f.Counters[i].Identity) < key(f.Counters[j].Route, f.Counters[j].Identity)
+	})
+
+	if err := store.WriteJSON(p, f); err != nil {
+		mu.Lock()
+		dirty = true
+		mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Check reports whether identity still has budget left on the route
+func Check(route *config.Route, identity string, now time.Time) (Status, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	ct := counter(route.Path, identity, now, false)
+	st := status(ct, route.Quota, now)
+
+	q := route.Quota
+	exceeded := (q.Daily > 0 && ct.DayUsed >= q.Daily) || (q.Monthly > 0 && ct.MonthUsed >= q.Monthly)
+	return st, !exceeded
+}
+
+// Add records tokens spent by identity on the route
+func Add(route, identity string, tokens int64, now time.Time) {
+	if tokens <= 0 {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	ct := counter(route, identity, now, true)
+	ct.DayUsed += tokens
+	ct.MonthUsed += tokens
+	dirty = true
+}
+
+// Reset clears the counters matching route and identity, an empty value
+// matches everything. It returns the number of counters removed.
+func Reset(route, identity string) int {
+	mu.Lock()
+	defer mu.Unlock()
+
+	n := 0
+	for k, ct := range counters {
+		if (route == "" || ct.Route == route) && (identity == "" || ct.Identity == identity) {
+			delete(counters, k)
+			n++
+		}
+	}
+	if n > 0 {
+		dirty = true
+	}
+	return n
+}
+
+// Snapshot returns the budget of every identity on routes that have a quota
+func Snapshot(cfg *config.RoutesConfig, now time.Time) []Status {
+	quotas := make(map[string]*config.Quota)
+	for i := range cfg.Routes {
+		if cfg.Routes[i].Quota != nil {
+			quotas[cfg.Routes[i].Path] = cfg.Routes[i].Quota
+		}
+	}
+
+	mu.Lock()
+	list := make([]Status, 0, len(counters))
+	for _, ct := range counters {
+		if q, ok := quotas[ct.Route]; ok {
+			roll(ct, now)
+			list = append(list, status(ct, q, now))
+		}
+	}
+	mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Route != list[j].Route {
+			return list[i].Route < list[j].Route
+		}
+		return list[i].Identity < list[j].Identity
+	})
+	return list
+}
+
+// counter returns the counter of identity on route with expired periods
+// cleared. mu must be held.
+func counter(route, identity string, now time.Time, create bool) *Counter {
+	k := key(route, identity)
+	ct, ok := counters[k]
+	if !ok {
+		ct = &Counter{Route: route, Identity: identity}
+		if create {
+			counters[k] = ct
+		}
+	}
+	roll(ct, now)
+	return ct
+}
+
+func roll(ct *Counter, now time.Time) {
+	day, month := now.UTC().Format("2006-01-02"), now.UTC().Format("2006-01")
+	if ct.Day != day {
+		ct.Day, ct.DayUsed = day, 0
+	}
+	if ct.Month != month {
+		ct.Month, ct.MonthUsed = month, 0
+	}
+}
+
+func status(ct *Counter, q *config.Quota, now time.Time) Status {
+	utc := now.UTC()
+	st := Status{
+		Route:          ct.Route,
+		Identity:       ct.Identity,
+		DailyLimit:     q.Daily,
+		DailyUsed:      ct.DayUsed,
+		DailyResetAt:   time.Date(utc.Year(), utc.Month(), utc.Day()+1, 0, 0, 0, 0, time.UTC),
+		MonthlyLimit:   q.Monthly,
+		MonthlyUsed:    ct.MonthUsed,
+		MonthlyResetAt: time.Date(utc.Year(), utc.Month()+1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if q.Daily > 0 {
+		st.DailyRemaining = remaining(q.Daily, ct.DayUsed)
+	}
+	if q.Monthly > 0 {
+		st.MonthlyRemaining = remaining(q.Monthly, ct.MonthUsed)
+	}
+	return st
+}
+
+// ResetAt returns when the exhausted budget of st frees up again
+func (st Status) ResetAt() time.Time {
+	if st.DailyRemaining != nil && *st.DailyRemaining == 0 &&
+		(st.MonthlyRemaining == nil || *st.MonthlyRemaining > 0) {
+		return st.DailyResetAt
+	}
+	return st.MonthlyResetAt
+}
+
+func remaining(limit, used int64) *int64 {
+	r := limit - used
+	if r < 0 {
+		r = 0
+	}
+	return &r
+}
+
+func key(route, identity string) string {
+	return route + "|" + identity
+}
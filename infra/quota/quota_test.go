@@ -0,0 +1,81 @@
+package quota
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/poixeai/proxify/infra/config"
+)
+
+func TestQuotaRejectsOverBudgetAndRollsOver(t *testing.T) {
+	defer Reset("", "")
+
+	route := &config.Route{Path: "/openai", Quota: &config.Quota{Daily: 100, Monthly: 1000}}
+	now := time.Date(2026, 3, 14, 23, 0, 0, 0, time.UTC)
+
+	if _, ok := Check(route, "ip:1.2.3.4", now); !ok {
+		t.Fatal("expected fresh identity to have budget")
+	}
+
+	Add(route.Path, "ip:1.2.3.4", 100, now)
+	st, ok := Check(route, "ip:1.2.3.4", now)
+	if ok {
+		t.Fatal("expected identity to be over its daily budget")
+	}
+	if *st.DailyRemaining != 0 || *st.MonthlyRemaining != 900 || !st.ResetAt().Equal(st.DailyResetAt) {
+		t.Fatalf("unexpected status %+v", st)
+	}
+
+	if _, ok := Check(route, "ip:5.6.7.8", now); !ok {
+		t.Fatal("expected budgets to be independent per identity")
+	}
+	if _, ok := Check(route, "ip:1.2.3.4", now.Add(2*time.Hour)); !ok {
+		t.Fatal("expected daily budget to reset the next day")
+	}
+
+	if n := Reset("/openai", "ip:1.2.3.4"); n != 1 {
+		t.Fatalf("expected one counter reset, got %d", n)
+	}
+}
+
+func TestQuotaCountersSurviveReload(t *testing.T) {
+	defer func() {
+		Reset("", "")
+		mu.Lock()
+		path = ""
+		mu.Unlock()
+	}()
+
+	p := filepath.Join(t.TempDir(), "quota.json")
+	if err := Open(p); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	Add("/claude", "key:team-a", 42, now)
+	Add("/claude", "key:gone", 7, now.AddDate(0, -2, 0))
+	if err := Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a restart
+	mu.Lock()
+	counters = make(map[string]*Counter)
+	mu.Unlock()
+	if err := Open(p); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.RoutesConfig{Routes: []config.Route{{Path: "/claude", Quota: &config.Quota{Monthly: 50}}}}
+	list := Snapshot(cfg, now)
+	if len(list) != 1 || list[0].MonthlyUsed != 42 || *list[0].MonthlyRemaining != 8 {
+		t.Fatalf("expected persisted counter after reload, got %+v", list)
+	}
+	mu.Lock()
+	_, kept := counters[key("/claude", "key:gone")]
+	mu.Unlock()
+	if kept {
+		t.Fatal("expected a counter of a past month to be dropped on flush")
+	}
+}
@@ -0,0 +1,166 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit describes a token bucket
+type Limit struct {
+	Rate  float64 // tokens refilled per second
+	Burst int     // bucket size
+}
+
+// Request asks a bucket for Cost tokens. A zero Cost only checks that the
+// bucket is not empty, used for limits whose cost is charged afterwards.
+type Request struct {
+	Key   string
+	Limit Limit
+	Cost  float64
+}
+
+// Result of taking from one or more buckets
+type Result struct {
+	Allowed    bool
+	Remaining  int           // tokens left in the emptiest bucket
+	RetryAfter time.Duration // when every bucket can serve the request, zero if allowed
+	Rejected   int           // index of the request that rejected, -1 if allowed
+}
+
+// Backend stores token buckets. The in-memory backend is the default, a
+// shared store (like a Redis-compatible server) can be plugged in with
+// SetBackend so several gateway instances enforce one limit together.
+type Backend interface {
+	// Take takes from every bucket, or from none when one of them is short
+	Take(ctx context.Context, reqs []Request, now time.Time) (Result, error)
+
+	// Charge removes n tokens without checking, the bucket may go into debt
+	Charge(ctx context.Context, key string, limit Limit, n float64, now time.Time) error
+}
+
+var (
+	backendMu sync.RWMutex
+	backend   Backend = NewMemoryBackend()
+)
+
+func SetBackend(b Backend) {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	backend = b
+}
+
+func GetBackend() Backend {
+	backendMu.RLock()
+	defer backendMu.RUnlock()
+	return backend
+}
+
+// Take takes from all buckets of reqs in the current backend
+func Take(ctx context.Context, reqs ...Request) (Result, error) {
+	return GetBackend().Take(ctx, reqs, time.Now())
+}
+
+// Charge removes n tokens from the bucket named key in the current backend
+func Charge(ctx context.Context, key string, limit Limit, n float64) error {
+	return GetBackend().Charge(ctx, key, limit, n, time.Now())
+}
+
+/* --------------------- Memory Backend ---------------------- */
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// MemoryBackend keeps buckets in process memory
+type MemoryBackend struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// how often idle buckets are looked for
+const sweepInterval = 10 * time.Minute
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *MemoryBackend) Take(_ context.Context, reqs []Request, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(now)
+
+	// check every bucket first, a rejected request costs nothing
+	res := Result{Allowed: true, Remaining: -1, Rejected: -1}
+	buckets := make([]*bucket, len(reqs))
+	for i, r := range reqs {
+		b := m.bucket(r.Key, r.Limit, now)
+		buckets[i] = b
+		if need := math.Max(r.Cost, 1); b.tokens < need {
+			wait := time.Duration((need - b.tokens) / r.Limit.Rate * float64(time.Second))
+			if res.Allowed || wait > res.RetryAfter {
+				res = Result{RetryAfter: wait, Rejected: i}
+			}
+		}
+	}
+	if !res.Allowed {
+		return res, nil
+	}
+
+	for i, r := range reqs {
+		b := buckets[i]
+		b.tokens -= r.Cost
+		if res.Remaining < 0 || int(b.tokens) < res.Remaining {
+			res.Remaining = int(b.tokens)
+		}
+	}
+	res.Remaining = max(res.Remaining, 0)
+	return res, nil
+}
+
+func (m *MemoryBackend) Charge(_ context.Context, key string, limit Limit, n float64, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.bucket(key, limit, now).tokens -= n
+	return nil
+}
+
+// bucket returns the bucket named key, refilled for the elapsed time
+func (m *MemoryBackend) bucket(key string, limit Limit, now time.Time) *bucket {
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		m.buckets[key] = b
+	}
+	b.limit = limit
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.Rate)
+		b.last = now
+	}
+	return b
+}
+
+// sweep drops buckets that have been idle long enough to be full again,
+// forgetting them is the same as keeping a full bucket
+func (m *MemoryBackend) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+
+	for k, b := range m.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate >= float64(b.limit.Burst) {
+			delete(m.buckets, k)
+		}
+	}
+}
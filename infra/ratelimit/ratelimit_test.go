@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryBackendRejectsWhenEmptyAndRefills(t *testing.T) {
+	m := NewMemoryBackend()
+	limit := Limit{Rate: 1, Burst: 2}
+	now := time.Now()
+	take := func(key string, at time.Time) Result {
+		res, _ := m.Take(context.Background(), []Request{{Key: key, Limit: limit, Cost: 1}}, at)
+		return res
+	}
+
+	for i := 0; i < 2; i++ {
+		if !take("k", now).Allowed {
+			t.Fatalf("expected request %d within burst to be allowed", i+1)
+		}
+	}
+
+	res := take("k", now)
+	if res.Allowed {
+		t.Fatal("expected request over burst to be rejected")
+	}
+	if res.RetryAfter <= 0 || res.RetryAfter > time.Second {
+		t.Fatalf("expected retry after within one second, got %v", res.RetryAfter)
+	}
+
+	if !take("other", now).Allowed {
+		t.Fatal("expected buckets to be independent per key")
+	}
+
+	if !take("k", now.Add(time.Second)).Allowed {
+		t.Fatal("expected bucket to refill after one second")
+	}
+}
+
+func TestMemoryBackendRejectedTakeCostsNothing(t *testing.T) {
+	m := NewMemoryBackend()
+	now := time.Now()
+	wide := Request{Key: "wide", Limit: Limit{Rate: 1, Burst: 5}, Cost: 1}
+	narrow := Request{Key: "narrow", Limit: Limit{Rate: 1, Burst: 1}, Cost: 1}
+
+	if res, _ := m.Take(context.Background(), []Request{wide, narrow}, now); !res.Allowed {
+		t.Fatal("expected first request to be allowed")
+	}
+	res, _ := m.Take(context.Background(), []Request{wide, narrow}, now)
+	if res.Allowed || res.Rejected != 1 {
+		t.Fatalf("expected narrow limit to reject, got %+v", res)
+	}
+
+	if res, _ := m.Take(context.Background(), []Request{wide}, now); !res.Allowed || res.Remaining != 3 {
+		t.Fatalf("expected rejected request to leave the wide bucket alone, got %+v", res)
+	}
+}
+
+func TestMemoryBackendChargeGoesIntoDebt(t *testing.T) {
+	m := NewMemoryBackend()
+	now := time.Now()
+	tokens := Request{Key: "t", Limit: Limit{Rate: 100, Burst: 100}}
+
+	if res, _ := m.Take(context.Background(), []Request{tokens}, now); !res.Allowed {
+		t.Fatal("expected a full token bucket to allow")
+	}
+	_ = m.Charge(context.Background(), "t", tokens.Limit, 300, now)
+
+	res, _ := m.Take(context.Background(), []Request{tokens}, now.Add(time.Second))
+	if res.Allowed {
+		t.Fatal("expected a bucket in debt to reject")
+	}
+	if res.RetryAfter <= time.Second || res.RetryAfter > 2*time.Second {
+		t.Fatalf("expected the debt to be paid back first, got retry after %v", res.RetryAfter)
+	}
+}
+
+type denyBackend struct{}
+
+func (denyBackend) Take(context.Context, []Request, time.Time) (Result, error) {
+	return Result{RetryAfter: time.Minute}, nil
+}
+
+func (denyBackend) Charge(context.Context, string, Limit, float64, time.Time) error {
+	return nil
+}
+
+func TestSetBackendReplacesStore(t *testing.T) {
+	prev := GetBackend()
+	defer SetBackend(prev)
+
+	SetBackend(denyBackend{})
+	res, err := Take(context.Background(), Request{Key: "k", Limit: Limit{Rate: 100, Burst: 100}, Cost: 1})
+	if err != nil || res.Allowed {
+		t.Fatalf("expected custom backend to decide, got %+v, %v", res, err)
+	}
+}
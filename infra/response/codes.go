@@ -5,4 +5,9 @@ const (
 	INVALID_REQUEST_ERROR = "invalid_request_error"
 	SERVICE_UNAVAILABLE   = "service_unavailable"
 	NOT_FOUND_ERROR       = "not_found_error"
+	UPSTREAM_ERROR        = "upstream_error"
+	TIMEOUT_ERROR         = "timeout_error"
+	RATE_LIMIT_ERROR      = "rate_limit_error"
+	QUOTA_EXCEEDED_ERROR  = "quota_exceeded_error"
+	PERMISSION_ERROR      = "permission_error"
 )
@@ -2,7 +2,10 @@ package response
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/poixeai/proxify/infra/ctx"
@@ -54,6 +57,80 @@ func RespondBadRequestError(c *gin.Context) {
 	)
 }
 
+func RespondModelNotAllowedError(c *gin.Context, route, model string) {
+	RespondError(
+		c,
+		http.StatusBadRequest,
+		fmt.Sprintf("Bad Request: model [%s] is not allowed on route [%s].", model, route),
+		INVALID_REQUEST_ERROR,
+	)
+}
+
+func RespondServiceUnavailableError(c *gin.Context, message string) {
+	RespondError(
+		c,
+		http.StatusServiceUnavailable,
+		message,
+		SERVICE_UNAVAILABLE,
+	)
+}
+
+func RespondUpstreamError(c *gin.Context) {
+	RespondError(
+		c,
+		http.StatusBadGateway,
+		"Bad Gateway: no upstream target could be reached. Please try again later.",
+		UPSTREAM_ERROR,
+	)
+}
+
+func RespondGatewayTimeoutError(c *gin.Context) {
+	RespondError(
+		c,
+		http.StatusGatewayTimeout,
+		"Gateway Timeout: the upstream target did not respond in time. Please try again later.",
+		TIMEOUT_ERROR,
+	)
+}
+
+func RespondRateLimitError(c *gin.Context, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+
+	RespondError(
+		c,
+		http.StatusTooManyRequests,
+		fmt.Sprintf("Too Many Requests: rate limit exceeded. Please retry after %d seconds.", seconds),
+		RATE_LIMIT_ERROR,
+	)
+}
+
+func RespondQuotaExceededError(c *gin.Context, period string, resetAt time.Time) {
+	if wait := time.Until(resetAt); wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	}
+
+	RespondError(
+		c,
+		http.StatusTooManyRequests,
+		fmt.Sprintf("Quota Exceeded: the %s token budget of this client is used up. It resets at %s.",
+			period, resetAt.UTC().Format(time.RFC3339)),
+		QUOTA_EXCEEDED_ERROR,
+	)
+}
+
+func RespondForbiddenError(c *gin.Context, message string) {
+	RespondError(
+		c,
+		http.StatusForbidden,
+		message,
+		PERMISSION_ERROR,
+	)
+}
+
 func RespondTopRouteNotFoundError(c *gin.Context) {
 	fullPath := c.Request.URL.Path
 	method := c.Request.Method
@@ -0,0 +1,47 @@
+package stream
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// TimeoutEvent builds an SSE error event in the format of the provider the
+// client is talking to, derived from the request path
+func TimeoutEvent(path string, err error) []byte {
+	message := "Upstream stream timed out: " + err.Error()
+
+	switch {
+	// anthropic /v1/messages
+	case strings.HasSuffix(path, "/messages"):
+		data, _ := json.Marshal(map[string]interface{}{
+			"type": "error",
+			"error": map[string]string{
+				"type":    "timeout_error",
+				"message": message,
+			},
+		})
+		return []byte("event: error\ndata: " + string(data) + "\n\n")
+
+	// gemini :streamGenerateContent
+	case strings.Contains(path, ":streamGenerateContent"):
+		data, _ := json.Marshal(map[string]interface{}{
+			"error": map[string]interface{}{
+				"code":    504,
+				"message": message,
+				"status":  "DEADLINE_EXCEEDED",
+			},
+		})
+		return []byte("data: " + string(data) + "\n\n")
+
+	// openai and compatible
+	default:
+		data, _ := json.Marshal(map[string]interface{}{
+			"error": map[string]interface{}{
+				"message": message,
+				"type":    "timeout_error",
+				"code":    "upstream_timeout",
+			},
+		})
+		return []byte("data: " + string(data) + "\n\n")
+	}
+}
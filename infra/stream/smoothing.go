@@ -11,6 +11,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/poixeai/proxify/infra/logger"
+	"github.com/poixeai/proxify/infra/metrics"
+	"github.com/poixeai/proxify/infra/transport"
 )
 
 type chunk struct {
@@ -21,7 +23,7 @@ func Smoothing(c *gin.Context, resp *http.Response) {
 	ctx := c.Request.Context()
 
 	// ==== Upstream Reader Layer ====
-	in := readUpstreamChunks(ctx, resp.Body)
+	in := readUpstreamChunks(ctx, resp.Body, c.Request.URL.Path)
 
 	// ==== Flow Control Layer ====
 	out := applyFlowControl(ctx, in)
@@ -30,7 +32,7 @@ func Smoothing(c *gin.Context, resp *http.Response) {
 	writeToClient(c, resp, out)
 }
 
-func readUpstreamChunks(ctx context.Context, body io.ReadCloser) <-chan chunk {
+func readUpstreamChunks(ctx context.Context, body io.ReadCloser, path string) <-chan chunk {
 	// ch := make(chan chunk)
 	ch := make(chan chunk, 100) // add some cache
 
@@ -45,6 +47,14 @@ func readUpstreamChunks(ctx context.Context, body io.ReadCloser) <-chan chunk {
 				if err != io.EOF {
 					logger.Errorf("error reading upstream: %v", err)
 				}
+
+				// stalled upstream, push an error event through the normal pipeline
+				if transport.IsTimeout(err) {
+					select {
+					case <-ctx.Done():
+					case ch <- chunk{body: TimeoutEvent(path, err)}:
+					}
+				}
 				return
 			}
 
@@ -134,6 +144,7 @@ func applyFlowControl(ctx context.Context, in <-chan chunk) <-chan chunk {
 					// All chunks have been sent, about to exit the sending goroutine
 					if !doneSeenAt.IsZero() {
 						tailDrain := time.Since(doneSeenAt)
+						metrics.SmoothingTailDrain.Observe(tailDrain.Seconds())
 						logger.Infof("[FlowControl] Tail drain duration tail_drain=%v", tailDrain)
 					}
 					return
@@ -151,6 +162,7 @@ func applyFlowControl(ctx context.Context, in <-chan chunk) <-chan chunk {
 				if len(buf) > cap(buf)-10 && currentInterval > minInterval {
 					currentInterval = minInterval
 					ticker.Reset(currentInterval)
+					metrics.SmoothingIntervalAdjustments.Inc("sprint")
 					if debugLog {
 						logger.Infof("[FlowControl] Sprint: buffer %d/%d, interval forcibly set to %dms",
 							len(buf), cap(buf), currentInterval.Milliseconds())
@@ -162,6 +174,7 @@ func applyFlowControl(ctx context.Context, in <-chan chunk) <-chan chunk {
 					if currentInterval != minInterval {
 						currentInterval = minInterval
 						ticker.Reset(currentInterval)
+						metrics.SmoothingIntervalAdjustments.Inc("tail")
 					}
 
 					// Rate-limited logging
@@ -187,6 +200,7 @@ func applyFlowControl(ctx context.Context, in <-chan chunk) <-chan chunk {
 				// Periodic adjustment
 				if time.Since(lastAdjustTime) >= adjustPeriod && !(tailBoost && doneFlag) && totalChunks > 5 {
 					bufLen := len(buf)
+					metrics.SmoothingBufferOccupancy.Observe(float64(bufLen) / float64(cap(buf)))
 					elapsed := time.Since(startTime)
 					historicalRate := float64(totalChunks) / elapsed.Seconds() // chunks/s
 
@@ -216,6 +230,7 @@ func applyFlowControl(ctx context.Context, in <-chan chunk) <-chan chunk {
 						if newInterval != currentInterval {
 							currentInterval = newInterval
 							ticker.Reset(currentInterval)
+							metrics.SmoothingIntervalAdjustments.Inc("adjust")
 							if debugLog {
 								logger.Debugf("[FlowControl] Adjusting send rate, buffer:%d historical rate:%.2f/s new interval:%dms",
 									bufLen, historicalRate, currentInterval.Milliseconds())
@@ -235,12 +250,7 @@ func writeToClient(c *gin.Context, resp *http.Response, out <-chan chunk) {
 	w := c.Writer
 	ctx := c.Request.Context()
 
-	// === 1. Copy upstream Header ===
-	for k, vv := range resp.Header {
-		for _, v := range vv {
-			w.Header().Add(k, v)
-		}
-	}
+	// === 1. Upstream header and status are already committed by the proxy ===
 	w.WriteHeader(resp.StatusCode)
 
 	flusher, ok := w.(http.Flusher)
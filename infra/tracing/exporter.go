@@ -0,0 +1,305 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/poixeai/proxify/infra/logger"
+)
+
+// Standard OpenTelemetry environment variables
+const (
+	EndpointEnv       = "OTEL_EXPORTER_OTLP_ENDPOINT"        // like http://localhost:4318, /v1/traces is appended
+	TracesEndpointEnv = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT" // full url, takes precedence
+	HeadersEnv        = "OTEL_EXPORTER_OTLP_HEADERS"         // k1=v1,k2=v2
+	ServiceNameEnv    = "OTEL_SERVICE_NAME"
+)
+
+const (
+	defaultServiceName = "proxify"
+	scopeName          = "github.com/poixeai/proxify"
+
+	queueSize     = 2048
+	batchSize     = 512
+	batchInterval = 5 * time.Second
+	exportTimeout = 10 * time.Second
+)
+
+// Config of the OTLP/HTTP exporter, spans are sent as JSON
+type Config struct {
+	Endpoint    string // full traces url, tracing is disabled when empty
+	Headers     map[string]string
+	ServiceName string
+}
+
+// ConfigFromEnv reads the exporter config from the standard OTEL_* variables
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Endpoint:    strings.TrimSpace(os.Getenv(TracesEndpointEnv)),
+		ServiceName: strings.TrimSpace(os.Getenv(ServiceNameEnv)),
+		Headers:     make(map[string]string),
+	}
+	if cfg.Endpoint == "" {
+		if base := strings.TrimSpace(os.Getenv(EndpointEnv)); base != "" {
+			cfg.Endpoint = strings.TrimRight(base, "/") + "/v1/traces"
+		}
+	}
+	for _, kv := range strings.Split(os.Getenv(HeadersEnv), ",") {
+		if k, v, ok := strings.Cut(kv, "="); ok && strings.TrimSpace(k) != "" {
+			cfg.Headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return cfg
+}
+
+type exporter struct {
+	cfg    Config
+	client *http.Client
+	queue  chan *Span
+	flush  chan chan struct{}
+}
+
+var (
+	current atomic.Pointer[exporter]
+	initMu  sync.Mutex
+)
+
+// Init starts exporting spans to cfg.Endpoint. Without an endpoint tracing
+// stays disabled and every span call is a no-op.
+func Init(cfg Config) {
+	initMu.Lock()
+	defer initMu.Unlock()
+
+	if cfg.Endpoint == "" {
+		current.Store(nil)
+		return
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = defaultServiceName
+	}
+
+	e := &exporter{
+		cfg:    cfg,
+		client: &http.Client{Timeout: exportTimeout},
+		queue:  make(chan *Span, queueSize),
+		flush:  make(chan chan struct{}),
+	}
+	go e.run()
+	current.Store(e)
+
+	logger.Infof("[Tracing] OTLP exporter enabled, endpoint=%s, service=%s", cfg.Endpoint, cfg.ServiceName)
+}
+
+// Enabled reports whether spans are exported
+func Enabled() bool {
+	return current.Load() != nil
+}
+
+// Flush exports every queued span and waits until done
+func Flush() {
+	e := current.Load()
+	if e == nil {
+		return
+	}
+	done := make(chan struct{})
+	e.flush <- done
+	<-done
+}
+
+func enqueue(s *Span) {
+	e := current.Load()
+	if e == nil {
+		return
+	}
+	select {
+	case e.queue <- s:
+	default:
+		// never block requests on a slow collector
+		logger.Warnf("[Tracing] export queue full, span %s dropped", s.name)
+	}
+}
+
+func (e *exporter) run() {
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, batchSize)
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.export(batch); err != nil {
+			logger.Errorf("[Tracing] export of %d spans failed: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case s := <-e.queue:
+			batch = append(batch, s)
+			if len(batch) >= batchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case done := <-e.flush:
+			for drained := false; !drained; {
+				select {
+				case s := <-e.queue:
+					batch = append(batch, s)
+				default:
+					drained = true
+				}
+			}
+			send()
+			close(done)
+		}
+	}
+}
+
+func (e *exporter) export(spans []*Span) error {
+	body, err := json.Marshal(e.payload(spans))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+/* --------------------- OTLP JSON ---------------------- */
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"` // int64 as string
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func (e *exporter) payload(spans []*Span) otlpRequest {
+	var scope otlpScopeSpans
+	scope.Scope.Name = scopeName
+	for _, s := range spans {
+		scope.Spans = append(scope.Spans, s.otlp())
+	}
+
+	var rs otlpResourceSpans
+	rs.Resource.Attributes = []otlpKeyValue{keyValue("service.name", e.cfg.ServiceName)}
+	rs.ScopeSpans = []otlpScopeSpans{scope}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{rs}}
+}
+
+func (s *Span) otlp() otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := otlpSpan{
+		TraceID:           hex.EncodeToString(s.sc.TraceID[:]),
+		SpanID:            hex.EncodeToString(s.sc.SpanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		Status:            otlpStatus{Code: s.status, Message: s.message},
+	}
+	if s.parent != [8]byte{} {
+		out.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	for _, a := range s.attributes {
+		out.Attributes = append(out.Attributes, keyValue(a.key, a.value))
+	}
+	return out
+}
+
+func keyValue(key string, value any) otlpKeyValue {
+	kv := otlpKeyValue{Key: key}
+	switch v := value.(type) {
+	case bool:
+		kv.Value.BoolValue = &v
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		kv.Value.IntValue = &s
+	case float64:
+		kv.Value.DoubleValue = &v
+	case string:
+		kv.Value.StringValue = &v
+	default:
+		s := fmt.Sprint(v)
+		kv.Value.StringValue = &s
+	}
+	return kv
+}
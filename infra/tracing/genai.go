@@ -0,0 +1,26 @@
+package tracing
+
+import "github.com/poixeai/proxify/infra/usage"
+
+// SetGenAI records models and token usage with GenAI semantic convention
+// attribute names. model is the requested model, empty when the body named
+// none, and u may be nil when the upstream reported no usage.
+func SetGenAI(s *Span, model string, u *usage.Usage, stream bool) {
+	if s == nil {
+		return
+	}
+
+	s.SetAttr("gen_ai.request.stream", stream)
+	if model != "" {
+		s.SetAttr("gen_ai.request.model", model)
+	}
+	if u == nil {
+		return
+	}
+	if u.Model != "" {
+		s.SetAttr("gen_ai.response.model", u.Model)
+	}
+	s.SetAttr("gen_ai.usage.input_tokens", u.PromptTokens)
+	s.SetAttr("gen_ai.usage.output_tokens", u.CompletionTokens)
+	s.SetAttr("gen_ai.usage.cache_read.input_tokens", u.CachedTokens)
+}
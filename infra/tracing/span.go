@@ -0,0 +1,223 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Span kinds, values as defined by OTLP
+const (
+	KindServer = 2
+	KindClient = 3
+)
+
+// Status codes, values as defined by OTLP
+const (
+	statusUnset = 0
+	statusOK    = 1
+	statusError = 2
+)
+
+// SpanContext identifies a span across process boundaries
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Span is one timed operation. A nil span is valid and records nothing,
+// so callers never need to check whether tracing is enabled.
+type Span struct {
+	sc     SpanContext
+	parent [8]byte
+	name   string
+	kind   int
+	start  time.Time
+
+	mu         sync.Mutex
+	end        time.Time
+	attributes []attribute
+	status     int
+	message    string
+	ended      bool
+}
+
+type attribute struct {
+	key   string
+	value any // string, bool, int64 or float64
+}
+
+type spanKey struct{}
+
+// StartSpan starts a span as a child of the span in ctx, or of the remote
+// parent extracted into ctx. It returns nil when tracing is disabled.
+func StartSpan(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	if !Enabled() {
+		return ctx, nil
+	}
+
+	parent := SpanContextFrom(ctx)
+	s := &Span{
+		name:  name,
+		kind:  kind,
+		start: time.Now(),
+	}
+
+	if parent.IsValid() {
+		s.sc.TraceID = parent.TraceID
+		s.sc.Sampled = parent.Sampled
+		s.parent = parent.SpanID
+	} else {
+		rand.Read(s.sc.TraceID[:])
+		s.sc.Sampled = true
+	}
+	rand.Read(s.sc.SpanID[:])
+
+	return context.WithValue(ctx, spanKey{}, s.sc), s
+}
+
+// SpanContextFrom returns the current span context of ctx, if any
+func SpanContextFrom(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanKey{}).(SpanContext)
+	return sc
+}
+
+// SetName renames the span, for names only known once the request is routed
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = name
+}
+
+// SetAttr sets an attribute, value is a string, bool, integer or float
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+
+	switch v := value.(type) {
+	case int:
+		value = int64(v)
+	case int32:
+		value = int64(v)
+	case float32:
+		value = float64(v)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.attributes {
+		if s.attributes[i].key == key {
+			s.attributes[i].value = value
+			return
+		}
+	}
+	s.attributes = append(s.attributes, attribute{key: key, value: value})
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status, s.message = statusError, message
+}
+
+// SetOK marks the span as successful, unless it already failed
+func (s *Span) SetOK() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status != statusError {
+		s.status = statusOK
+	}
+}
+
+// End finishes the span and queues it for export, later calls do nothing
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.sc.Sampled {
+		enqueue(s)
+	}
+}
+
+/* --------------------- W3C Trace Context ---------------------- */
+
+const traceparentHeader = "traceparent"
+
+// Extract reads a W3C traceparent header into ctx, so spans started from
+// it continue the caller's trace
+func Extract(ctx context.Context, h http.Header) context.Context {
+	sc, ok := parseTraceparent(h.Get(traceparentHeader))
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, sc)
+}
+
+// Inject writes the span context of ctx as a W3C traceparent header
+func Inject(ctx context.Context, h http.Header) {
+	sc := SpanContextFrom(ctx)
+	if !sc.IsValid() {
+		return
+	}
+
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	h.Set(traceparentHeader, "00-"+hex.EncodeToString(sc.TraceID[:])+"-"+hex.EncodeToString(sc.SpanID[:])+"-"+flags)
+}
+
+func parseTraceparent(v string) (SpanContext, bool) {
+	var sc SpanContext
+
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&0x01 == 1
+
+	return sc, sc.IsValid()
+}
@@ -0,0 +1,118 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/poixeai/proxify/infra/usage"
+)
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	in := http.Header{}
+	in.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx := Extract(context.Background(), in)
+	sc := SpanContextFrom(ctx)
+	if !sc.IsValid() || !sc.Sampled {
+		t.Fatalf("expected a sampled remote parent, got %+v", sc)
+	}
+
+	out := http.Header{}
+	Inject(ctx, out)
+	if got := out.Get("traceparent"); got != in.Get("traceparent") {
+		t.Fatalf("expected traceparent to round trip, got %q", got)
+	}
+
+	for _, bad := range []string{"", "00-xyz-00f067aa0ba902b7-01", "00-00000000000000000000000000000000-00f067aa0ba902b7-01"} {
+		h := http.Header{}
+		h.Set("traceparent", bad)
+		if SpanContextFrom(Extract(context.Background(), h)).IsValid() {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestExporterSendsOTLPJSON(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received otlpRequest
+		headers  http.Header
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		headers = r.Header.Clone()
+		json.Unmarshal(body, &received)
+	}))
+	defer collector.Close()
+
+	Init(Config{Endpoint: collector.URL + "/v1/traces", Headers: map[string]string{"X-Tenant": "gw"}})
+	defer Init(Config{})
+
+	in := http.Header{}
+	in.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, server := StartSpan(Extract(context.Background(), in), "POST /openai", KindServer)
+	server.SetAttr("proxify.request_id", "req-1")
+	_, client := StartSpan(ctx, "POST", KindClient)
+	client.SetAttr("gen_ai.usage.input_tokens", 12)
+	client.SetError("boom")
+	client.End()
+	server.End()
+
+	Flush()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if headers.Get("Content-Type") != "application/json" || headers.Get("X-Tenant") != "gw" {
+		t.Fatalf("unexpected export headers %v", headers)
+	}
+	if len(received.ResourceSpans) != 1 || len(received.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected payload %+v", received)
+	}
+	spans := received.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("expected two spans, got %d", len(spans))
+	}
+
+	c, s := spans[0], spans[1]
+	if s.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || s.ParentSpanID != "00f067aa0ba902b7" || s.Kind != KindServer {
+		t.Fatalf("expected server span to continue the remote trace, got %+v", s)
+	}
+	if c.TraceID != s.TraceID || c.ParentSpanID != s.SpanID || c.Kind != KindClient {
+		t.Fatalf("expected client span to be a child of the server span, got %+v", c)
+	}
+	if c.Status.Code != statusError || *c.Attributes[0].Value.IntValue != "12" {
+		t.Fatalf("unexpected client span status or attributes %+v", c)
+	}
+	if !strings.Contains(*s.Attributes[0].Value.StringValue, "req-1") {
+		t.Fatalf("expected request id attribute, got %+v", s.Attributes)
+	}
+}
+
+func TestSetGenAIRecordsRequestModel(t *testing.T) {
+	s := &Span{}
+	SetGenAI(s, "gpt-4o", &usage.Usage{Model: "gpt-4o-2024-11-20", PromptTokens: 12}, true)
+
+	attrs := make(map[string]any)
+	for _, a := range s.attributes {
+		attrs[a.key] = a.value
+	}
+	if attrs["gen_ai.request.model"] != "gpt-4o" || attrs["gen_ai.response.model"] != "gpt-4o-2024-11-20" {
+		t.Fatalf("expected request and response models, got %v", attrs)
+	}
+
+	s = &Span{}
+	SetGenAI(s, "", nil, false)
+	for _, a := range s.attributes {
+		if a.key == "gen_ai.request.model" {
+			t.Fatalf("expected no request model without one in the body, got %v", a.value)
+		}
+	}
+}
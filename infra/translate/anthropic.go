@@ -0,0 +1,622 @@
+package translate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Anthropic Messages wire types
+
+type messagesRequest struct {
+	Model         string             `json:"model"`
+	System        json.RawMessage    `json:"system,omitempty"` // string or text blocks
+	Messages      []anthropicMessage `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+	Tools         []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice    *struct {
+		Type                   string `json:"type"` // auto | any | tool | none
+		Name                   string `json:"name,omitempty"`
+		DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
+	} `json:"tool_choice,omitempty"`
+	Metadata *struct {
+		UserID string `json:"user_id,omitempty"`
+	} `json:"metadata,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content anthropicContent `json:"content"`
+}
+
+// anthropicContent is either a plain string or a list of blocks
+type anthropicContent []anthropicBlock
+
+func (c *anthropicContent) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*c = anthropicContent{{Type: "text", Text: s}}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]anthropicBlock)(c))
+}
+
+type anthropicBlock struct {
+	Type string `json:"type"` // text | image | tool_use | tool_result | thinking
+
+	Text string `json:"text,omitempty"`
+
+	Source *struct {
+		Type      string `json:"type"` // base64 | url
+		MediaType string `json:"media_type,omitempty"`
+		Data      string `json:"data,omitempty"`
+		URL       string `json:"url,omitempty"`
+	} `json:"source,omitempty"`
+
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	ToolUseID string            `json:"tool_use_id,omitempty"`
+	Content   *anthropicContent `json:"content,omitempty"`
+	IsError   bool              `json:"is_error,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema,omitempty"`
+}
+
+type anthropicUsage struct {
+	InputTokens          int `json:"input_tokens"`
+	OutputTokens         int `json:"output_tokens"`
+	CacheReadInputTokens int `json:"cache_read_input_tokens,omitempty"`
+}
+
+type anthropicResponse struct {
+	ID           string           `json:"id"`
+	Type         string           `json:"type"`
+	Role         string           `json:"role"`
+	Model        string           `json:"model"`
+	Content      []map[string]any `json:"content"`
+	StopReason   *string          `json:"stop_reason"`
+	StopSequence *string          `json:"stop_sequence"`
+	Usage        anthropicUsage   `json:"usage"`
+}
+
+/* --------------------- Request ---------------------- */
+
+// anthropicToOpenAI serves Anthropic /v1/messages from an OpenAI-compatible
+// /v1/chat/completions upstream
+func anthropicToOpenAI(path string, body []byte) (*Request, Converter, error) {
+	p, query := splitPath(path)
+	if !strings.HasSuffix(p, "/messages") {
+		return nil, nil, nil
+	}
+
+	var in messagesRequest
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, nil, fmt.Errorf("invalid messages request: %w", err)
+	}
+
+	out := chatRequest{
+		Model:       in.Model,
+		Temperature: in.Temperature,
+		TopP:        in.TopP,
+		Stream:      in.Stream,
+	}
+	if in.MaxTokens > 0 {
+		out.MaxTokens = ptr(in.MaxTokens)
+	}
+	if in.Stream {
+		out.StreamOptions = &streamOptions{IncludeUsage: true}
+	}
+	if len(in.StopSequences) > 0 {
+		out.Stop, _ = json.Marshal(in.StopSequences)
+	}
+	if in.Metadata != nil {
+		out.User = in.Metadata.UserID
+	}
+
+	// system prompt
+	if system := systemText(in.System); system != "" {
+		out.Messages = append(out.Messages, chatMessage{Role: "system", Content: textContent(system)})
+	}
+
+	for _, m := range in.Messages {
+		out.Messages = append(out.Messages, toChatMessages(m)...)
+	}
+
+	// tools
+	for _, t := range in.Tools {
+		out.Tools = append(out.Tools, chatTool{
+			Type:     "function",
+			Function: chatFunction{Name: t.Name, Description: t.Description, Parameters: t.InputSchema},
+		})
+	}
+	if tc := in.ToolChoice; tc != nil {
+		switch tc.Type {
+		case "any":
+			out.ToolChoice = json.RawMessage(`"required"`)
+		case "none":
+			out.ToolChoice = json.RawMessage(`"none"`)
+		case "tool":
+			out.ToolChoice, _ = json.Marshal(map[string]any{"type": "function", "function": map[string]string{"name": tc.Name}})
+		default:
+			out.ToolChoice = json.RawMessage(`"auto"`)
+		}
+		if tc.DisableParallelToolUse && len(out.Tools) > 0 {
+			out.ParallelToolCalls = ptr(false)
+		}
+	}
+
+	data, err := json.Marshal(out)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req := &Request{
+		Path:   strings.TrimSuffix(p, "/messages") + "/chat/completions" + query,
+		Body:   data,
+		Stream: in.Stream,
+	}
+	return req, &anthropicConverter{model: in.Model, stopSequences: in.StopSequences}, nil
+}
+
+func systemText(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var c anthropicContent
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return ""
+	}
+	var parts []string
+	for _, b := range c {
+		if b.Type == "text" && b.Text != "" {
+			parts = append(parts, b.Text)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// toChatMessages converts one Anthropic message. Tool results become
+// separate tool messages, placed first so they follow the assistant's calls.
+func toChatMessages(m anthropicMessage) []chatMessage {
+	var (
+		out       []chatMessage
+		parts     []chatPart
+		toolCalls []chatToolCall
+	)
+
+	for _, b := range m.Content {
+		switch b.Type {
+		case "text":
+			parts = append(parts, chatPart{Type: "text", Text: b.Text})
+		case "image":
+			if b.Source == nil {
+				continue
+			}
+			url := b.Source.URL
+			if b.Source.Type == "base64" {
+				url = "data:" + b.Source.MediaType + ";base64," + b.Source.Data
+			}
+			parts = append(parts, chatPart{Type: "image_url", ImageURL: &chatImageURL{URL: url}})
+		case "tool_use":
+			call := chatToolCall{ID: b.ID, Type: "function"}
+			call.Function.Name = b.Name
+			call.Function.Arguments = "{}"
+			var args bytes.Buffer
+			if len(b.Input) > 0 && json.Compact(&args, b.Input) == nil {
+				call.Function.Arguments = args.String()
+			}
+			toolCalls = append(toolCalls, call)
+		case "tool_result":
+			content := ""
+			if b.Content != nil {
+				for _, inner := range *b.Content {
+					if inner.Type == "text" {
+						content += inner.Text
+					}
+				}
+			}
+			if b.IsError {
+				content = "Error: " + content
+			}
+			out = append(out, chatMessage{Role: "tool", ToolCallID: b.ToolUseID, Content: textContent(content)})
+		}
+		// thinking blocks carry provider signatures, there is no chat equivalent
+	}
+
+	if m.Role == "assistant" {
+		text := ""
+		for _, p := range parts {
+			text += p.Text
+		}
+		msg := chatMessage{Role: "assistant", ToolCalls: toolCalls}
+		if text != "" || len(toolCalls) == 0 {
+			msg.Content = textContent(text)
+		}
+		return append(out, msg)
+	}
+
+	if len(parts) > 0 {
+		content := &chatContent{Parts: parts}
+		if len(parts) == 1 && parts[0].Type == "text" {
+			content = textContent(parts[0].Text)
+		}
+		out = append(out, chatMessage{Role: m.Role, Content: content})
+	}
+	return out
+}
+
+/* --------------------- Response ---------------------- */
+
+type anthropicConverter struct {
+	model         string
+	stopSequences []string
+
+	// stream state
+	started   bool
+	finished  bool
+	id        string
+	index     int          // index of the last content block
+	open      string       // type of the last content block while open, empty when none
+	toolIndex map[int]int  // chat tool call index -> content block index
+	openTools map[int]bool // tool_use blocks still taking input deltas
+	stop      string
+	sequence  string // matched stop sequence
+	tail      string // end of the streamed text, long enough to hold any stop sequence
+	usage     *chatUsage
+}
+
+func (a *anthropicConverter) Headers(h http.Header) {
+	// anthropic clients send their key as x-api-key
+	if h.Get("Authorization") == "" {
+		if key := h.Get("X-Api-Key"); key != "" {
+			h.Set("Authorization", "Bearer "+key)
+		}
+	}
+	h.Del("X-Api-Key")
+	h.Del("Anthropic-Version")
+	h.Del("Anthropic-Beta")
+}
+
+func (a *anthropicConverter) Response(body []byte) ([]byte, error) {
+	var in chatResponse
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+
+	out := anthropicResponse{
+		ID:      anthropicID(in.ID),
+		Type:    "message",
+		Role:    "assistant",
+		Model:   orDefault(in.Model, a.model),
+		Content: []map[string]any{},
+		Usage:   anthropicUsageFrom(in.Usage),
+	}
+
+	stop := "end_turn"
+	if len(in.Choices) > 0 {
+		choice := in.Choices[0]
+		text := ""
+		if msg := choice.Message; msg != nil {
+			if text = msg.Content.String(); text != "" {
+				out.Content = append(out.Content, map[string]any{"type": "text", "text": text})
+			}
+			for _, call := range msg.ToolCalls {
+				out.Content = append(out.Content, map[string]any{
+					"type":  "tool_use",
+					"id":    call.ID,
+					"name":  call.Function.Name,
+					"input": toolInput(call.Function.Arguments),
+				})
+			}
+		}
+		if choice.FinishReason != nil {
+			stop = stopReason(*choice.FinishReason)
+			if seq := a.matchStop(*choice.FinishReason, choice.StopReason, text); seq != "" {
+				stop = "stop_sequence"
+				out.StopSequence = &seq
+			}
+		}
+	}
+	out.StopReason = &stop
+
+	return json.Marshal(out)
+}
+
+func (a *anthropicConverter) Event(_ string, data []byte) []byte {
+	if a.finished {
+		return nil
+	}
+	if bytes.Equal(data, []byte("[DONE]")) {
+		return a.End()
+	}
+
+	var chunk chatResponse
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return nil
+	}
+
+	var b bytes.Buffer
+	if !a.started {
+		a.start(&b, chunk.ID, chunk.Model)
+	}
+	if chunk.Usage != nil {
+		a.usage = chunk.Usage
+	}
+
+	for _, choice := range chunk.Choices {
+		if d := choice.Delta; d != nil {
+			if text := d.Content.String(); text != "" {
+				a.keepTail(text)
+				if a.open != "text" {
+					a.openBlock(&b, "text", map[string]any{"type": "text", "text": ""})
+				}
+				b.Write(sseEvent("content_block_delta", map[string]any{
+					"type":  "content_block_delta",
+					"index": a.index,
+					"delta": map[string]any{"type": "text_delta", "text": text},
+				}))
+			}
+
+			for _, call := range d.ToolCalls {
+				i := 0
+				if call.Index != nil {
+					i = *call.Index
+				}
+				block, seen := a.toolIndex[i]
+				if !seen {
+					a.openTool(&b, map[string]any{
+						"type":  "tool_use",
+						"id":    call.ID,
+						"name":  call.Function.Name,
+						"input": map[string]any{},
+					})
+					block = a.index
+					a.toolIndex[i] = block
+				}
+				// a block closed by later text cannot take deltas anymore,
+				// chat upstreams send text before tool calls
+				if call.Function.Arguments != "" && a.openTools[block] {
+					b.Write(sseEvent("content_block_delta", map[string]any{
+						"type":  "content_block_delta",
+						"index": block,
+						"delta": map[string]any{"type": "input_json_delta", "partial_json": call.Function.Arguments},
+					}))
+				}
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			a.stop = stopReason(*choice.FinishReason)
+			if seq := a.matchStop(*choice.FinishReason, choice.StopReason, a.tail); seq != "" {
+				a.stop = "stop_sequence"
+				a.sequence = seq
+			}
+		}
+	}
+
+	return b.Bytes()
+}
+
+func (a *anthropicConverter) End() []byte {
+	if a.finished {
+		return nil
+	}
+	a.finished = true
+
+	var b bytes.Buffer
+	if !a.started {
+		a.start(&b, "", "")
+	}
+	a.closeBlock(&b)
+
+	stop := a.stop
+	if stop == "" {
+		stop = "end_turn"
+	}
+	var sequence *string
+	if a.sequence != "" {
+		sequence = &a.sequence
+	}
+	b.Write(sseEvent("message_delta", map[string]any{
+		"type":  "message_delta",
+		"delta": map[string]any{"stop_reason": stop, "stop_sequence": sequence},
+		"usage": anthropicUsageFrom(a.usage),
+	}))
+	b.Write(sseEvent("message_stop", map[string]any{"type": "message_stop"}))
+	return b.Bytes()
+}
+
+func (a *anthropicConverter) Error(status int, body []byte) []byte {
+	out, _ := json.Marshal(map[string]any{
+		"type": "error",
+		"error": map[string]any{
+			"type":    anthropicErrorType(status),
+			"message": errorMessage(body),
+		},
+	})
+	return out
+}
+
+func (a *anthropicConverter) start(b *bytes.Buffer, id, model string) {
+	a.started = true
+	a.toolIndex = make(map[int]int)
+	a.openTools = make(map[int]bool)
+	a.index = -1
+	a.id = anthropicID(id)
+
+	b.Write(sseEvent("message_start", map[string]any{
+		"type": "message_start",
+		"message": anthropicResponse{
+			ID:      a.id,
+			Type:    "message",
+			Role:    "assistant",
+			Model:   orDefault(model, a.model),
+			Content: []map[string]any{},
+		},
+	}))
+}
+
+// openBlock opens a content block, closing the blocks before it
+func (a *anthropicConverter) openBlock(b *bytes.Buffer, typ string, block map[string]any) {
+	a.closeBlock(b)
+	a.index++
+	a.open = typ
+	b.Write(sseEvent("content_block_start", map[string]any{
+		"type":          "content_block_start",
+		"index":         a.index,
+		"content_block": block,
+	}))
+}
+
+// openTool opens a tool_use block next to the tool blocks already open, so
+// upstreams may interleave the argument deltas of parallel calls
+func (a *anthropicConverter) openTool(b *bytes.Buffer, block map[string]any) {
+	if a.open == "text" {
+		a.closeBlock(b)
+	}
+	a.index++
+	a.open = "tool_use"
+	a.openTools[a.index] = true
+	b.Write(sseEvent("content_block_start", map[string]any{
+		"type":          "content_block_start",
+		"index":         a.index,
+		"content_block": block,
+	}))
+}
+
+// closeBlock closes every open content block in index order
+func (a *anthropicConverter) closeBlock(b *bytes.Buffer) {
+	if a.open == "" {
+		return
+	}
+	for i := 0; i <= a.index; i++ {
+		if a.open == "text" && i == a.index || a.openTools[i] {
+			b.Write(sseEvent("content_block_stop", map[string]any{"type": "content_block_stop", "index": i}))
+			delete(a.openTools, i)
+		}
+	}
+	a.open = ""
+}
+
+// matchStop returns the requested stop sequence a chat completion ended on.
+// Upstreams that report the matched string are trusted, otherwise the text
+// is checked for a trailing sequence as some keep it in the output.
+func (a *anthropicConverter) matchStop(finish string, reported json.RawMessage, text string) string {
+	if finish != "stop" || len(a.stopSequences) == 0 {
+		return ""
+	}
+	var matched string
+	if len(reported) > 0 && json.Unmarshal(reported, &matched) == nil {
+		if slices.Contains(a.stopSequences, matched) {
+			return matched
+		}
+		return ""
+	}
+	for _, seq := range a.stopSequences {
+		if seq != "" && strings.HasSuffix(text, seq) {
+			return seq
+		}
+	}
+	return ""
+}
+
+// keepTail appends streamed text to the tail matchStop looks at
+func (a *anthropicConverter) keepTail(text string) {
+	longest := 0
+	for _, seq := range a.stopSequences {
+		longest = max(longest, len(seq))
+	}
+	a.tail += text
+	if len(a.tail) > longest {
+		a.tail = a.tail[len(a.tail)-longest:]
+	}
+}
+
+func anthropicUsageFrom(u *chatUsage) anthropicUsage {
+	if u == nil {
+		return anthropicUsage{}
+	}
+	cached := u.cached()
+	return anthropicUsage{
+		InputTokens:          u.PromptTokens - cached,
+		OutputTokens:         u.CompletionTokens,
+		CacheReadInputTokens: cached,
+	}
+}
+
+func stopReason(finish string) string {
+	switch finish {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	case "content_filter":
+		return "refusal"
+	default:
+		return "end_turn"
+	}
+}
+
+func anthropicErrorType(status int) string {
+	switch {
+	case status == http.StatusBadRequest:
+		return "invalid_request_error"
+	case status == http.StatusUnauthorized:
+		return "authentication_error"
+	case status == http.StatusForbidden:
+		return "permission_error"
+	case status == http.StatusNotFound:
+		return "not_found_error"
+	case status == http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case status == http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case status == 529 || status == http.StatusServiceUnavailable:
+		return "overloaded_error"
+	default:
+		return "api_error"
+	}
+}
+
+// toolInput parses tool call arguments, models sometimes emit invalid JSON
+func toolInput(args string) any {
+	var v any
+	if err := json.Unmarshal([]byte(args), &v); err != nil || v == nil {
+		return map[string]any{}
+	}
+	return v
+}
+
+func anthropicID(id string) string {
+	if id == "" {
+		return fmt.Sprintf("msg_%d", time.Now().UnixNano())
+	}
+	if strings.HasPrefix(id, "msg_") {
+		return id
+	}
+	return "msg_" + strings.TrimPrefix(id, "chatcmpl-")
+}
+
+func orDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
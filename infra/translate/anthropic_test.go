@@ -0,0 +1,236 @@
+package translate
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestAnthropicRequestToChat(t *testing.T) {
+	body := `{
+		"model": "deepseek-chat",
+		"max_tokens": 1024,
+		"system": [{"type": "text", "text": "Be brief."}],
+		"stream": true,
+		"stop_sequences": ["END"],
+		"tools": [{"name": "get_weather", "description": "Weather", "input_schema": {"type": "object"}}],
+		"tool_choice": {"type": "any"},
+		"messages": [
+			{"role": "user", "content": [
+				{"type": "text", "text": "What is this?"},
+				{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "iVBOR"}}
+			]},
+			{"role": "assistant", "content": [
+				{"type": "text", "text": "Checking."},
+				{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"city": "Paris"}}
+			]},
+			{"role": "user", "content": [
+				{"type": "tool_result", "tool_use_id": "toolu_1", "content": "sunny"},
+				{"type": "text", "text": "Thanks"}
+			]}
+		]
+	}`
+
+	req, conv, err := anthropicToOpenAI("/v1/messages?beta=true", []byte(body))
+	if err != nil || req == nil || conv == nil {
+		t.Fatalf("expected translation, got req=%v err=%v", req, err)
+	}
+	if req.Path != "/v1/chat/completions?beta=true" || !req.Stream {
+		t.Fatalf("unexpected upstream request %s stream=%v", req.Path, req.Stream)
+	}
+
+	var out chatRequest
+	if err := json.Unmarshal(req.Body, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Model != "deepseek-chat" || *out.MaxTokens != 1024 || out.StreamOptions == nil || !out.StreamOptions.IncludeUsage {
+		t.Fatalf("unexpected request fields %+v", out)
+	}
+	if string(out.Stop) != `["END"]` || string(out.ToolChoice) != `"required"` || out.Tools[0].Function.Name != "get_weather" {
+		t.Fatalf("unexpected stop/tools %s %s %+v", out.Stop, out.ToolChoice, out.Tools)
+	}
+
+	roles := []string{}
+	for _, m := range out.Messages {
+		roles = append(roles, m.Role)
+	}
+	if strings.Join(roles, ",") != "system,user,assistant,tool,user" {
+		t.Fatalf("unexpected message order %v", roles)
+	}
+	if img := out.Messages[1].Content.Parts[1]; img.ImageURL == nil || img.ImageURL.URL != "data:image/png;base64,iVBOR" {
+		t.Fatalf("expected image as data url, got %+v", img)
+	}
+	if call := out.Messages[2].ToolCalls[0]; call.ID != "toolu_1" || call.Function.Arguments != `{"city":"Paris"}` {
+		t.Fatalf("unexpected tool call %+v", call)
+	}
+	if tool := out.Messages[3]; tool.ToolCallID != "toolu_1" || tool.Content.String() != "sunny" {
+		t.Fatalf("unexpected tool result %+v", tool)
+	}
+
+	if req, _, _ := anthropicToOpenAI("/v1/models", nil); req != nil {
+		t.Fatal("expected other endpoints to pass through")
+	}
+}
+
+func TestAnthropicResponseFromChat(t *testing.T) {
+	_, conv, _ := anthropicToOpenAI("/v1/messages", []byte(`{"model":"m","max_tokens":10,"messages":[]}`))
+
+	out, err := conv.Response([]byte(`{
+		"id": "chatcmpl-1", "model": "deepseek-chat",
+		"choices": [{"index": 0, "finish_reason": "tool_calls", "message": {"role": "assistant", "content": "Let me check.",
+			"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}]}}],
+		"usage": {"prompt_tokens": 20, "completion_tokens": 5, "total_tokens": 25, "prompt_tokens_details": {"cached_tokens": 8}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msg anthropicResponse
+	json.Unmarshal(out, &msg)
+	if msg.ID != "msg_1" || msg.Type != "message" || *msg.StopReason != "tool_use" {
+		t.Fatalf("unexpected message %s", out)
+	}
+	if len(msg.Content) != 2 || msg.Content[0]["text"] != "Let me check." || msg.Content[1]["name"] != "get_weather" {
+		t.Fatalf("unexpected content %s", out)
+	}
+	if input := msg.Content[1]["input"].(map[string]any); input["city"] != "Paris" {
+		t.Fatalf("expected parsed tool input, got %s", out)
+	}
+	if msg.Usage != (anthropicUsage{InputTokens: 12, OutputTokens: 5, CacheReadInputTokens: 8}) {
+		t.Fatalf("unexpected usage %+v", msg.Usage)
+	}
+
+	errBody := conv.Error(429, []byte(`{"error":{"message":"slow down","type":"rate_limit"}}`))
+	if !bytes.Contains(errBody, []byte(`"type":"rate_limit_error"`)) || !bytes.Contains(errBody, []byte("slow down")) {
+		t.Fatalf("unexpected error body %s", errBody)
+	}
+}
+
+func TestAnthropicStopSequence(t *testing.T) {
+	req := []byte(`{"model":"m","max_tokens":10,"stop_sequences":["END","###"],"messages":[]}`)
+
+	cases := []struct {
+		name   string
+		choice string
+		stop   string
+		seq    string
+	}{
+		{"reported by upstream", `{"finish_reason":"stop","stop_reason":"###","message":{"role":"assistant","content":"done"}}`, "stop_sequence", "###"},
+		{"kept in the text", `{"finish_reason":"stop","message":{"role":"assistant","content":"done END"}}`, "stop_sequence", "END"},
+		{"natural end", `{"finish_reason":"stop","message":{"role":"assistant","content":"done"}}`, "end_turn", ""},
+		{"token id reported", `{"finish_reason":"stop","stop_reason":42,"message":{"role":"assistant","content":"done"}}`, "end_turn", ""},
+	}
+	for _, tc := range cases {
+		_, conv, _ := anthropicToOpenAI("/v1/messages", req)
+		out, err := conv.Response([]byte(`{"id":"chatcmpl-1","choices":[` + tc.choice + `]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg anthropicResponse
+		json.Unmarshal(out, &msg)
+		seq := ""
+		if msg.StopSequence != nil {
+			seq = *msg.StopSequence
+		}
+		if *msg.StopReason != tc.stop || seq != tc.seq {
+			t.Errorf("%s: unexpected stop %s", tc.name, out)
+		}
+	}
+
+	_, conv, _ := anthropicToOpenAI("/v1/messages", []byte(`{"model":"m","max_tokens":10,"stream":true,"stop_sequences":["END"],"messages":[]}`))
+	upstream := strings.Join([]string{
+		`data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{"content":"done E"},"finish_reason":null}]}`,
+		`data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{"content":"ND"},"finish_reason":null}]}`,
+		`data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+		`data: [DONE]`,
+	}, "\n\n") + "\n\n"
+	out, err := io.ReadAll(NewStreamReader(io.NopCloser(strings.NewReader(upstream)), conv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `"stop_reason":"stop_sequence","stop_sequence":"END"`) {
+		t.Fatalf("expected the stream to end on the stop sequence, got %s", out)
+	}
+}
+
+func TestAnthropicStreamFromChat(t *testing.T) {
+	_, conv, _ := anthropicToOpenAI("/v1/messages", []byte(`{"model":"m","max_tokens":10,"stream":true,"messages":[]}`))
+
+	upstream := strings.Join([]string{
+		`data: {"id":"chatcmpl-1","model":"deepseek-chat","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}`,
+		`data: {"id":"chatcmpl-1","model":"deepseek-chat","choices":[{"index":0,"delta":{"content":"Hi"},"finish_reason":null}]}`,
+		`: keep-alive`,
+		`data: {"id":"chatcmpl-1","model":"deepseek-chat","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]},"finish_reason":null}]}`,
+		`data: {"id":"chatcmpl-1","model":"deepseek-chat","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]},"finish_reason":null}]}`,
+		`data: {"id":"chatcmpl-1","model":"deepseek-chat","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		`data: {"id":"chatcmpl-1","model":"deepseek-chat","choices":[],"usage":{"prompt_tokens":9,"completion_tokens":3,"total_tokens":12}}`,
+		`data: [DONE]`,
+	}, "\n\n") + "\n\n"
+
+	r := NewStreamReader(io.NopCloser(strings.NewReader(upstream)), conv)
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var events []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "event: ") {
+			events = append(events, strings.TrimPrefix(line, "event: "))
+		}
+	}
+	want := "message_start,content_block_start,content_block_delta,content_block_stop,content_block_start,content_block_delta,content_block_stop,message_delta,message_stop"
+	if strings.Join(events, ",") != want {
+		t.Fatalf("unexpected event sequence\n got %s\nwant %s", strings.Join(events, ","), want)
+	}
+	for _, s := range []string{`"text":"Hi"`, `"partial_json":"{\"city\":"`, `"stop_reason":"tool_use"`, `"input_tokens":9`, `"output_tokens":3`} {
+		if !strings.Contains(string(out), s) {
+			t.Errorf("expected stream to contain %s", s)
+		}
+	}
+}
+
+func TestAnthropicStreamInterleavedToolCalls(t *testing.T) {
+	_, conv, _ := anthropicToOpenAI("/v1/messages", []byte(`{"model":"m","max_tokens":10,"stream":true,"messages":[]}`))
+
+	upstream := strings.Join([]string{
+		`data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"a","arguments":"{\"x\":"}}]}}]}`,
+		`data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_b","type":"function","function":{"name":"b","arguments":"{\"y\":2}"}}]}}]}`,
+		`data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"1}"}}]},"finish_reason":"tool_calls"}]}`,
+		`data: [DONE]`,
+	}, "\n\n") + "\n\n"
+
+	out, err := io.ReadAll(NewStreamReader(io.NopCloser(strings.NewReader(upstream)), conv))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every delta must land before its block stops
+	stopped := make(map[float64]bool)
+	for _, line := range strings.Split(string(out), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		var ev struct {
+			Type  string  `json:"type"`
+			Index float64 `json:"index"`
+		}
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			t.Fatal(err)
+		}
+		switch ev.Type {
+		case "content_block_delta":
+			if stopped[ev.Index] {
+				t.Fatalf("delta for block %v after its stop:\n%s", ev.Index, out)
+			}
+		case "content_block_stop":
+			stopped[ev.Index] = true
+		}
+	}
+	if !stopped[0] || !stopped[1] || !strings.Contains(string(out), `"index":0,"type":"content_block_delta"`) {
+		t.Fatalf("expected both tool blocks to take their deltas and stop, got %s", out)
+	}
+}
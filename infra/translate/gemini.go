@@ -0,0 +1,642 @@
+package translate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Gemini generateContent wire types
+
+type geminiRequest struct {
+	Contents          []geminiContent   `json:"contents"`
+	SystemInstruction *geminiContent    `json:"systemInstruction,omitempty"`
+	Tools             []geminiTool      `json:"tools,omitempty"`
+	ToolConfig        *geminiToolConfig `json:"toolConfig,omitempty"`
+	GenerationConfig  *geminiGenConfig  `json:"generationConfig,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"` // user | model
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text             string              `json:"text,omitempty"`
+	Thought          bool                `json:"thought,omitempty"`
+	InlineData       *geminiBlob         `json:"inlineData,omitempty"`
+	FileData         *geminiFile         `json:"fileData,omitempty"`
+	FunctionCall     *geminiFunctionCall `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResp `json:"functionResponse,omitempty"`
+}
+
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type geminiFile struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+type geminiFunctionCall struct {
+	ID   string         `json:"id,omitempty"`
+	Name string         `json:"name"`
+	Args map[string]any `json:"args,omitempty"`
+}
+
+type geminiFunctionResp struct {
+	ID       string         `json:"id,omitempty"`
+	Name     string         `json:"name"`
+	Response map[string]any `json:"response"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDecl `json:"functionDeclarations"`
+}
+
+type geminiFunctionDecl struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+}
+
+type geminiToolConfig struct {
+	FunctionCallingConfig struct {
+		Mode                 string   `json:"mode"` // AUTO | ANY | NONE
+		AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+	} `json:"functionCallingConfig"`
+}
+
+type geminiGenConfig struct {
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"topP,omitempty"`
+	MaxOutputTokens  *int     `json:"maxOutputTokens,omitempty"`
+	StopSequences    []string `json:"stopSequences,omitempty"`
+	CandidateCount   *int     `json:"candidateCount,omitempty"`
+	Seed             *int64   `json:"seed,omitempty"`
+	PresencePenalty  *float64 `json:"presencePenalty,omitempty"`
+	FrequencyPenalty *float64 `json:"frequencyPenalty,omitempty"`
+	ResponseMimeType string   `json:"responseMimeType,omitempty"`
+	ResponseSchema   any      `json:"responseSchema,omitempty"`
+}
+
+func (g *geminiGenConfig) empty() bool {
+	return g.Temperature == nil && g.TopP == nil && g.MaxOutputTokens == nil &&
+		len(g.StopSequences) == 0 && g.CandidateCount == nil && g.Seed == nil &&
+		g.PresencePenalty == nil && g.FrequencyPenalty == nil &&
+		g.ResponseMimeType == "" && g.ResponseSchema == nil
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content      *geminiContent `json:"content"`
+		FinishReason string         `json:"finishReason"`
+		Index        int            `json:"index"`
+	} `json:"candidates"`
+	UsageMetadata *struct {
+		PromptTokenCount        int `json:"promptTokenCount"`
+		CandidatesTokenCount    int `json:"candidatesTokenCount"`
+		ThoughtsTokenCount      int `json:"thoughtsTokenCount"`
+		CachedContentTokenCount int `json:"cachedContentTokenCount"`
+		TotalTokenCount         int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+	ModelVersion string `json:"modelVersion"`
+	ResponseID   string `json:"responseId"`
+}
+
+/* --------------------- Request ---------------------- */
+
+// openAIToGemini serves OpenAI /v1/chat/completions from the Gemini API
+func openAIToGemini(p string, body []byte) (*Request, Converter, error) {
+	p, query := splitPath(p)
+	if !strings.HasSuffix(p, "/chat/completions") {
+		return nil, nil, nil
+	}
+
+	var in chatRequest
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, nil, fmt.Errorf("invalid chat completions request: %w", err)
+	}
+	if in.Model == "" {
+		return nil, nil, fmt.Errorf("model is required")
+	}
+	model := strings.TrimPrefix(in.Model, "models/")
+
+	out := geminiRequest{}
+	if err := geminiContents(&out, in.Messages); err != nil {
+		return nil, nil, err
+	}
+
+	// tools
+	var decls []geminiFunctionDecl
+	for _, t := range in.Tools {
+		if t.Type != "" && t.Type != "function" {
+			continue
+		}
+		decls = append(decls, geminiFunctionDecl{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			Parameters:  geminiSchema(t.Function.Parameters),
+		})
+	}
+	if len(decls) > 0 {
+		out.Tools = []geminiTool{{FunctionDeclarations: decls}}
+	}
+	if len(in.ToolChoice) > 0 {
+		out.ToolConfig = geminiToolChoice(in.ToolChoice)
+	}
+
+	// generation config
+	gen := geminiGenConfig{
+		Temperature:      in.Temperature,
+		TopP:             in.TopP,
+		MaxOutputTokens:  in.MaxCompletionTokens,
+		StopSequences:    stopList(in.Stop),
+		CandidateCount:   in.N,
+		Seed:             in.Seed,
+		PresencePenalty:  in.PresencePenalty,
+		FrequencyPenalty: in.FrequencyPenalty,
+	}
+	if gen.MaxOutputTokens == nil {
+		gen.MaxOutputTokens = in.MaxTokens
+	}
+	if rf := in.ResponseFormat; rf != nil {
+		switch rf.Type {
+		case "json_object":
+			gen.ResponseMimeType = "application/json"
+		case "json_schema":
+			gen.ResponseMimeType = "application/json"
+			if rf.JSONSchema != nil {
+				gen.ResponseSchema = geminiSchema(rf.JSONSchema.Schema)
+			}
+		}
+	}
+	if !gen.empty() {
+		out.GenerationConfig = &gen
+	}
+
+	data, err := json.Marshal(out)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	method := ":generateContent"
+	if in.Stream {
+		method = ":streamGenerateContent"
+		if query == "" {
+			query = "?alt=sse"
+		} else {
+			query += "&alt=sse"
+		}
+	}
+
+	req := &Request{
+		Path:   "/v1beta/models/" + model + method + query,
+		Body:   data,
+		Stream: in.Stream,
+	}
+	conv := &geminiConverter{
+		model:        in.Model,
+		includeUsage: in.StreamOptions != nil && in.StreamOptions.IncludeUsage,
+	}
+	return req, conv, nil
+}
+
+// geminiContents maps chat messages to contents, merging consecutive turns
+// of the same role as gemini requires strictly alternating turns
+func geminiContents(out *geminiRequest, messages []chatMessage) error {
+	var system []string
+	toolNames := make(map[string]string) // tool call id -> function name
+
+	add := func(role string, parts ...geminiPart) {
+		if len(parts) == 0 {
+			return
+		}
+		if n := len(out.Contents); n > 0 && out.Contents[n-1].Role == role {
+			out.Contents[n-1].Parts = append(out.Contents[n-1].Parts, parts...)
+			return
+		}
+		out.Contents = append(out.Contents, geminiContent{Role: role, Parts: parts})
+	}
+
+	for _, m := range messages {
+		switch m.Role {
+		case "system", "developer":
+			if text := m.Content.String(); text != "" {
+				system = append(system, text)
+			}
+
+		case "assistant":
+			var parts []geminiPart
+			if text := m.Content.String(); text != "" {
+				parts = append(parts, geminiPart{Text: text})
+			}
+			for _, call := range m.ToolCalls {
+				toolNames[call.ID] = call.Function.Name
+				var args map[string]any
+				json.Unmarshal([]byte(call.Function.Arguments), &args)
+				parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{Name: call.Function.Name, Args: args}})
+			}
+			add("model", parts...)
+
+		case "tool", "function":
+			name := toolNames[m.ToolCallID]
+			if name == "" {
+				name = m.Name
+			}
+			var result any
+			text := m.Content.String()
+			if err := json.Unmarshal([]byte(text), &result); err != nil {
+				result = text
+			}
+			add("user", geminiPart{FunctionResponse: &geminiFunctionResp{
+				Name:     name,
+				Response: map[string]any{"content": result},
+			}})
+
+		default:
+			parts, err := geminiUserParts(m.Content)
+			if err != nil {
+				return err
+			}
+			add("user", parts...)
+		}
+	}
+
+	if len(system) > 0 {
+		out.SystemInstruction = &geminiContent{Parts: []geminiPart{{Text: strings.Join(system, "\n\n")}}}
+	}
+	if len(out.Contents) == 0 {
+		return fmt.Errorf("messages must contain at least one user or assistant message")
+	}
+	return nil
+}
+
+func geminiUserParts(c *chatContent) ([]geminiPart, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.Parts == nil {
+		if c.Text == "" {
+			return nil, nil
+		}
+		return []geminiPart{{Text: c.Text}}, nil
+	}
+
+	var parts []geminiPart
+	for _, p := range c.Parts {
+		switch p.Type {
+		case "text":
+			parts = append(parts, geminiPart{Text: p.Text})
+		case "image_url":
+			if p.ImageURL == nil {
+				continue
+			}
+			url := p.ImageURL.URL
+			if rest, ok := strings.CutPrefix(url, "data:"); ok {
+				meta, data, found := strings.Cut(rest, ",")
+				if !found || !strings.HasSuffix(meta, ";base64") {
+					return nil, fmt.Errorf("unsupported image data url")
+				}
+				parts = append(parts, geminiPart{InlineData: &geminiBlob{MimeType: strings.TrimSuffix(meta, ";base64"), Data: data}})
+				continue
+			}
+			mt := mime.TypeByExtension(path.Ext(strings.SplitN(url, "?", 2)[0]))
+			if mt == "" {
+				mt = "image/jpeg"
+			}
+			parts = append(parts, geminiPart{FileData: &geminiFile{MimeType: mt, FileURI: url}})
+		}
+	}
+	return parts, nil
+}
+
+func geminiToolChoice(raw json.RawMessage) *geminiToolConfig {
+	cfg := &geminiToolConfig{}
+
+	var mode string
+	if json.Unmarshal(raw, &mode) == nil {
+		switch mode {
+		case "none":
+			cfg.FunctionCallingConfig.Mode = "NONE"
+		case "required":
+			cfg.FunctionCallingConfig.Mode = "ANY"
+		default:
+			cfg.FunctionCallingConfig.Mode = "AUTO"
+		}
+		return cfg
+	}
+
+	var named struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if json.Unmarshal(raw, &named) == nil && named.Function.Name != "" {
+		cfg.FunctionCallingConfig.Mode = "ANY"
+		cfg.FunctionCallingConfig.AllowedFunctionNames = []string{named.Function.Name}
+		return cfg
+	}
+	return nil
+}
+
+// unsupportedSchemaKeys are JSON Schema keywords gemini's OpenAPI subset rejects
+var unsupportedSchemaKeys = []string{"$schema", "$id", "additionalProperties", "strict"}
+
+// geminiSchema strips keywords gemini does not accept from a JSON schema
+func geminiSchema(raw json.RawMessage) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil
+	}
+	return cleanSchema(v)
+}
+
+func cleanSchema(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for _, k := range unsupportedSchemaKeys {
+			delete(t, k)
+		}
+		for k, inner := range t {
+			t[k] = cleanSchema(inner)
+		}
+	case []any:
+		for i := range t {
+			t[i] = cleanSchema(t[i])
+		}
+	}
+	return v
+}
+
+func stopList(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var one string
+	if json.Unmarshal(raw, &one) == nil {
+		if one == "" {
+			return nil
+		}
+		return []string{one}
+	}
+	var many []string
+	json.Unmarshal(raw, &many)
+	return many
+}
+
+/* --------------------- Response ---------------------- */
+
+type geminiConverter struct {
+	model        string
+	includeUsage bool
+
+	// stream state
+	started  bool
+	finished bool
+	id       string
+	created  int64
+	calls    int // tool calls sent so far, their stream index
+	finish   map[int]string
+	usage    *chatUsage
+}
+
+func (g *geminiConverter) Headers(h http.Header) {
+	// openai clients send their key as a bearer token
+	if key, ok := strings.CutPrefix(h.Get("Authorization"), "Bearer "); ok && h.Get("X-Goog-Api-Key") == "" {
+		h.Set("X-Goog-Api-Key", key)
+	}
+	h.Del("Authorization")
+	h.Del("Openai-Organization")
+	h.Del("Openai-Project")
+}
+
+func (g *geminiConverter) Response(body []byte) ([]byte, error) {
+	var in geminiResponse
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+
+	out := chatResponse{
+		ID:      chatID(in.ResponseID),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   orDefault(in.ModelVersion, g.model),
+		Choices: []chatChoice{},
+		Usage:   geminiUsage(&in),
+	}
+
+	for _, cand := range in.Candidates {
+		msg := &chatMessage{Role: "assistant"}
+		text, reasoning, calls := geminiParts(cand.Content, 0)
+		if text != "" || len(calls) == 0 {
+			msg.Content = textContent(text)
+		}
+		msg.ReasoningContent = reasoning
+		msg.ToolCalls = calls
+
+		out.Choices = append(out.Choices, chatChoice{
+			Index:        cand.Index,
+			Message:      msg,
+			FinishReason: ptr(finishReason(cand.FinishReason, len(calls) > 0)),
+		})
+	}
+
+	return json.Marshal(out)
+}
+
+func (g *geminiConverter) Event(_ string, data []byte) []byte {
+	if g.finished {
+		return nil
+	}
+
+	var in geminiResponse
+	if err := json.Unmarshal(data, &in); err != nil {
+		return nil
+	}
+
+	var b bytes.Buffer
+	if !g.started {
+		g.started = true
+		g.id = chatID(in.ResponseID)
+		g.created = time.Now().Unix()
+		g.finish = make(map[int]string)
+		if in.ModelVersion != "" {
+			g.model = in.ModelVersion
+		}
+	}
+	if u := geminiUsage(&in); u != nil {
+		g.usage = u
+	}
+
+	for _, cand := range in.Candidates {
+		text, reasoning, calls := geminiParts(cand.Content, g.calls)
+		g.calls += len(calls)
+
+		if text != "" || reasoning != "" || len(calls) > 0 {
+			delta := &chatMessage{Role: "assistant", ToolCalls: calls, ReasoningContent: reasoning}
+			if text != "" {
+				delta.Content = textContent(text)
+			}
+			b.Write(g.chunk([]chatChoice{{Index: cand.Index, Delta: delta}}, nil))
+		}
+		if cand.FinishReason != "" {
+			g.finish[cand.Index] = finishReason(cand.FinishReason, g.calls > 0)
+		}
+	}
+
+	return b.Bytes()
+}
+
+func (g *geminiConverter) End() []byte {
+	if g.finished {
+		return nil
+	}
+	g.finished = true
+	if !g.started {
+		return []byte("data: [DONE]\n\n")
+	}
+
+	// finish reasons are held back so usage, which gemini sends with the
+	// last event, can travel with them
+	var choices []chatChoice
+	for _, i := range slices.Sorted(maps.Keys(g.finish)) {
+		choices = append(choices, chatChoice{Index: i, Delta: &chatMessage{}, FinishReason: ptr(g.finish[i])})
+	}
+	if len(choices) == 0 {
+		choices = []chatChoice{{Delta: &chatMessage{}, FinishReason: ptr("stop")}}
+	}
+
+	var b bytes.Buffer
+	if g.includeUsage {
+		b.Write(g.chunk(choices, nil))
+		b.Write(g.chunk([]chatChoice{}, g.usage))
+	} else {
+		b.Write(g.chunk(choices, g.usage))
+	}
+	b.WriteString("data: [DONE]\n\n")
+	return b.Bytes()
+}
+
+func (g *geminiConverter) Error(status int, body []byte) []byte {
+	var e chatError
+	e.Error.Message = errorMessage(body)
+	e.Error.Type = openAIErrorType(status)
+	out, _ := json.Marshal(e)
+	return out
+}
+
+func (g *geminiConverter) chunk(choices []chatChoice, u *chatUsage) []byte {
+	out, _ := json.Marshal(chatResponse{
+		ID:      g.id,
+		Object:  "chat.completion.chunk",
+		Created: g.created,
+		Model:   g.model,
+		Choices: choices,
+		Usage:   u,
+	})
+	return append(append([]byte("data: "), out...), '\n', '\n')
+}
+
+// geminiParts splits a candidate into text, thought text and tool calls,
+// numbering the calls from index
+func geminiParts(c *geminiContent, index int) (string, string, []chatToolCall) {
+	if c == nil {
+		return "", "", nil
+	}
+
+	var text, reasoning strings.Builder
+	var calls []chatToolCall
+	for _, p := range c.Parts {
+		switch {
+		case p.FunctionCall != nil:
+			args, _ := json.Marshal(p.FunctionCall.Args)
+			if p.FunctionCall.Args == nil {
+				args = []byte("{}")
+			}
+			call := chatToolCall{Index: ptr(index), ID: p.FunctionCall.ID, Type: "function"}
+			if call.ID == "" {
+				call.ID = fmt.Sprintf("call_%d_%d", time.Now().UnixNano(), index)
+			}
+			call.Function.Name = p.FunctionCall.Name
+			call.Function.Arguments = string(args)
+			calls = append(calls, call)
+			index++
+		case p.Thought:
+			reasoning.WriteString(p.Text)
+		default:
+			text.WriteString(p.Text)
+		}
+	}
+	return text.String(), reasoning.String(), calls
+}
+
+func geminiUsage(in *geminiResponse) *chatUsage {
+	m := in.UsageMetadata
+	if m == nil {
+		return nil
+	}
+	u := &chatUsage{
+		PromptTokens:     m.PromptTokenCount,
+		CompletionTokens: m.CandidatesTokenCount + m.ThoughtsTokenCount,
+		TotalTokens:      m.TotalTokenCount,
+	}
+	if m.CachedContentTokenCount > 0 {
+		u.PromptTokensDetails = &struct {
+			CachedTokens int `json:"cached_tokens"`
+		}{m.CachedContentTokenCount}
+	}
+	if m.ThoughtsTokenCount > 0 {
+		u.CompletionTokensDetails = &struct {
+			ReasoningTokens int `json:"reasoning_tokens"`
+		}{m.ThoughtsTokenCount}
+	}
+	return u
+}
+
+func finishReason(reason string, toolCalls bool) string {
+	switch reason {
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return "content_filter"
+	}
+	if toolCalls {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+func openAIErrorType(status int) string {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return "authentication_error"
+	case status == http.StatusNotFound:
+		return "not_found_error"
+	case status == http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case status >= http.StatusInternalServerError:
+		return "server_error"
+	default:
+		return "invalid_request_error"
+	}
+}
+
+func chatID(id string) string {
+	if id == "" {
+		return fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano())
+	}
+	return "chatcmpl-" + id
+}
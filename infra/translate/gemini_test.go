@@ -0,0 +1,172 @@
+package translate
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestOpenAIRequestToGemini(t *testing.T) {
+	body := `{
+		"model": "gemini-2.5-flash",
+		"max_tokens": 256,
+		"temperature": 0.2,
+		"stop": "END",
+		"stream": true,
+		"response_format": {"type": "json_object"},
+		"tools": [{"type": "function", "function": {"name": "get_weather", "parameters": {"type": "object", "additionalProperties": false, "properties": {"city": {"type": "string"}}}}}],
+		"tool_choice": {"type": "function", "function": {"name": "get_weather"}},
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": [
+				{"type": "text", "text": "Weather here?"},
+				{"type": "image_url", "image_url": {"url": "data:image/png;base64,iVBOR"}}
+			]},
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "{\"sky\":\"sunny\"}"},
+			{"role": "user", "content": "Thanks"}
+		]
+	}`
+
+	req, conv, err := openAIToGemini("/v1/chat/completions?key=abc", []byte(body))
+	if err != nil || req == nil || conv == nil {
+		t.Fatalf("expected translation, got req=%v err=%v", req, err)
+	}
+	if req.Path != "/v1beta/models/gemini-2.5-flash:streamGenerateContent?key=abc&alt=sse" || !req.Stream {
+		t.Fatalf("unexpected upstream request %s stream=%v", req.Path, req.Stream)
+	}
+
+	var out geminiRequest
+	if err := json.Unmarshal(req.Body, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.SystemInstruction == nil || out.SystemInstruction.Parts[0].Text != "Be brief." {
+		t.Fatalf("unexpected system instruction %s", req.Body)
+	}
+
+	// the tool response and the following user text share one user turn
+	roles := []string{}
+	for _, c := range out.Contents {
+		roles = append(roles, c.Role)
+	}
+	if strings.Join(roles, ",") != "user,model,user" {
+		t.Fatalf("unexpected content order %v", roles)
+	}
+	if img := out.Contents[0].Parts[1].InlineData; img == nil || img.MimeType != "image/png" || img.Data != "iVBOR" {
+		t.Fatalf("expected inline image, got %s", req.Body)
+	}
+	if call := out.Contents[1].Parts[0].FunctionCall; call == nil || call.Name != "get_weather" || call.Args["city"] != "Paris" {
+		t.Fatalf("unexpected function call %s", req.Body)
+	}
+	if resp := out.Contents[2].Parts[0].FunctionResponse; resp == nil || resp.Name != "get_weather" {
+		t.Fatalf("unexpected function response %s", req.Body)
+	}
+
+	gen := out.GenerationConfig
+	if gen == nil || *gen.MaxOutputTokens != 256 || *gen.Temperature != 0.2 || gen.StopSequences[0] != "END" || gen.ResponseMimeType != "application/json" {
+		t.Fatalf("unexpected generation config %s", req.Body)
+	}
+	if strings.Contains(string(req.Body), "additionalProperties") {
+		t.Fatalf("expected unsupported schema keys to be removed, got %s", req.Body)
+	}
+	if tc := out.ToolConfig; tc == nil || tc.FunctionCallingConfig.Mode != "ANY" || tc.FunctionCallingConfig.AllowedFunctionNames[0] != "get_weather" {
+		t.Fatalf("unexpected tool config %s", req.Body)
+	}
+
+	h := http.Header{}
+	h.Set("Authorization", "Bearer sk-gemini")
+	conv.Headers(h)
+	if h.Get("Authorization") != "" || h.Get("X-Goog-Api-Key") != "sk-gemini" {
+		t.Fatalf("expected bearer key moved to x-goog-api-key, got %v", h)
+	}
+
+	if req, _, _ := openAIToGemini("/v1/models", nil); req != nil {
+		t.Fatal("expected other endpoints to pass through")
+	}
+}
+
+func TestOpenAIResponseFromGemini(t *testing.T) {
+	_, conv, _ := openAIToGemini("/v1/chat/completions", []byte(`{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hi"}]}`))
+
+	out, err := conv.Response([]byte(`{
+		"candidates": [{"index": 0, "finishReason": "STOP", "content": {"role": "model", "parts": [
+			{"text": "thinking...", "thought": true},
+			{"text": "Let me check."},
+			{"functionCall": {"name": "get_weather", "args": {"city": "Paris"}}}
+		]}}],
+		"usageMetadata": {"promptTokenCount": 20, "candidatesTokenCount": 5, "thoughtsTokenCount": 3, "cachedContentTokenCount": 8, "totalTokenCount": 28},
+		"modelVersion": "gemini-2.5-flash", "responseId": "abc"
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var resp chatResponse
+	json.Unmarshal(out, &resp)
+	if resp.ID != "chatcmpl-abc" || resp.Object != "chat.completion" || len(resp.Choices) != 1 {
+		t.Fatalf("unexpected response %s", out)
+	}
+	msg := resp.Choices[0].Message
+	if msg.Content.String() != "Let me check." || msg.ReasoningContent != "thinking..." || *resp.Choices[0].FinishReason != "tool_calls" {
+		t.Fatalf("unexpected message %s", out)
+	}
+	if call := msg.ToolCalls[0]; call.Function.Name != "get_weather" || call.Function.Arguments != `{"city":"Paris"}` || call.ID == "" {
+		t.Fatalf("unexpected tool call %s", out)
+	}
+	if u := resp.Usage; u.PromptTokens != 20 || u.CompletionTokens != 8 || u.TotalTokens != 28 || u.cached() != 8 {
+		t.Fatalf("unexpected usage %s", out)
+	}
+
+	errBody := conv.Error(400, []byte(`{"error":{"code":400,"message":"bad model","status":"INVALID_ARGUMENT"}}`))
+	if !strings.Contains(string(errBody), `"message":"bad model"`) || !strings.Contains(string(errBody), `"type":"invalid_request_error"`) {
+		t.Fatalf("unexpected error body %s", errBody)
+	}
+}
+
+func TestOpenAIStreamFromGemini(t *testing.T) {
+	_, conv, _ := openAIToGemini("/v1/chat/completions", []byte(`{"model":"gemini-2.5-flash","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"hi"}]}`))
+
+	upstream := strings.Join([]string{
+		`data: {"candidates":[{"index":0,"content":{"role":"model","parts":[{"text":"Hel"}]}}],"responseId":"abc","modelVersion":"gemini-2.5-flash"}`,
+		`data: {"candidates":[{"index":0,"content":{"role":"model","parts":[{"text":"lo"}]},"finishReason":"MAX_TOKENS"}],"usageMetadata":{"promptTokenCount":4,"candidatesTokenCount":2,"totalTokenCount":6}}`,
+	}, "\n\n") + "\n\n"
+
+	r := NewStreamReader(io.NopCloser(strings.NewReader(upstream)), conv)
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var chunks []chatResponse
+	var done bool
+	for _, line := range strings.Split(string(out), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+		var c chatResponse
+		if err := json.Unmarshal([]byte(data), &c); err != nil {
+			t.Fatalf("invalid chunk %s", data)
+		}
+		chunks = append(chunks, c)
+	}
+
+	if !done || len(chunks) != 4 {
+		t.Fatalf("expected 4 chunks and [DONE], got %s", out)
+	}
+	if chunks[0].Object != "chat.completion.chunk" || chunks[0].ID != "chatcmpl-abc" || chunks[0].Choices[0].Delta.Content.String() != "Hel" {
+		t.Fatalf("unexpected first chunk %s", out)
+	}
+	if *chunks[2].Choices[0].FinishReason != "length" {
+		t.Fatalf("expected length finish reason, got %s", out)
+	}
+	if u := chunks[3].Usage; len(chunks[3].Choices) != 0 || u == nil || u.TotalTokens != 6 {
+		t.Fatalf("expected trailing usage chunk, got %s", out)
+	}
+}
@@ -0,0 +1,591 @@
+package translate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAI Responses wire types
+
+type responsesRequest struct {
+	Model             string          `json:"model"`
+	Input             json.RawMessage `json:"input"` // string or items
+	Instructions      string          `json:"instructions,omitempty"`
+	MaxOutputTokens   *int            `json:"max_output_tokens,omitempty"`
+	Temperature       *float64        `json:"temperature,omitempty"`
+	TopP              *float64        `json:"top_p,omitempty"`
+	Stream            bool            `json:"stream,omitempty"`
+	Tools             []responsesTool `json:"tools,omitempty"`
+	ToolChoice        json.RawMessage `json:"tool_choice,omitempty"` // "auto" | "none" | "required" | {type, name}
+	ParallelToolCalls *bool           `json:"parallel_tool_calls,omitempty"`
+	Text              *struct {
+		Format *struct {
+			Type   string          `json:"type"` // text | json_object | json_schema
+			Name   string          `json:"name,omitempty"`
+			Schema json.RawMessage `json:"schema,omitempty"`
+			Strict *bool           `json:"strict,omitempty"`
+		} `json:"format,omitempty"`
+	} `json:"text,omitempty"`
+	Reasoning *struct {
+		Effort string `json:"effort,omitempty"`
+	} `json:"reasoning,omitempty"`
+	PreviousResponseID string `json:"previous_response_id,omitempty"`
+	User               string `json:"user,omitempty"`
+}
+
+type responsesTool struct {
+	Type        string          `json:"type"` // function
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+	Strict      *bool           `json:"strict,omitempty"`
+}
+
+// responsesItem is one input item, a message or a function call or its output
+type responsesItem struct {
+	Type    string          `json:"type,omitempty"` // message | function_call | function_call_output | reasoning
+	Role    string          `json:"role,omitempty"`
+	Content json.RawMessage `json:"content,omitempty"` // string or parts
+
+	CallID    string          `json:"call_id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Arguments string          `json:"arguments,omitempty"`
+	Output    json.RawMessage `json:"output,omitempty"` // string or parts
+}
+
+type responsesPart struct {
+	Type     string `json:"type"` // input_text | output_text | input_image | refusal
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Refusal  string `json:"refusal,omitempty"`
+}
+
+type responsesUsage struct {
+	InputTokens        int `json:"input_tokens"`
+	InputTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"input_tokens_details"`
+	OutputTokens        int `json:"output_tokens"`
+	OutputTokensDetails struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"output_tokens_details"`
+	TotalTokens int `json:"total_tokens"`
+}
+
+type responsesResponse struct {
+	ID                string           `json:"id"`
+	Object            string           `json:"object"`
+	CreatedAt         int64            `json:"created_at"`
+	Status            string           `json:"status"` // in_progress | completed | incomplete
+	Model             string           `json:"model"`
+	Output            []map[string]any `json:"output"`
+	IncompleteDetails map[string]any   `json:"incomplete_details"`
+	Error             any              `json:"error"`
+	Usage             *responsesUsage  `json:"usage"`
+}
+
+/* --------------------- Request ---------------------- */
+
+// responsesToChat serves OpenAI /v1/responses from a /v1/chat/completions upstream
+func responsesToChat(path string, body []byte) (*Request, Converter, error) {
+	p, query := splitPath(path)
+	if !strings.HasSuffix(p, "/responses") {
+		return nil, nil, nil
+	}
+
+	var in responsesRequest
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, nil, fmt.Errorf("invalid responses request: %w", err)
+	}
+	if in.PreviousResponseID != "" {
+		// responses are not stored, there is no conversation to continue
+		return nil, nil, fmt.Errorf("previous_response_id is not supported, send the full input instead")
+	}
+
+	out := chatRequest{
+		Model:             in.Model,
+		MaxTokens:         in.MaxOutputTokens,
+		Temperature:       in.Temperature,
+		TopP:              in.TopP,
+		Stream:            in.Stream,
+		ParallelToolCalls: in.ParallelToolCalls,
+		User:              in.User,
+	}
+	if in.Stream {
+		out.StreamOptions = &streamOptions{IncludeUsage: true}
+	}
+	if in.Reasoning != nil {
+		out.ReasoningEffort = in.Reasoning.Effort
+	}
+	if in.Text != nil && in.Text.Format != nil && in.Text.Format.Type != "text" {
+		f := in.Text.Format
+		out.ResponseFormat = &responseFormat{Type: f.Type}
+		if f.Type == "json_schema" {
+			out.ResponseFormat.JSONSchema = &struct {
+				Name   string          `json:"name,omitempty"`
+				Schema json.RawMessage `json:"schema,omitempty"`
+				Strict *bool           `json:"strict,omitempty"`
+			}{f.Name, f.Schema, f.Strict}
+		}
+	}
+
+	if in.Instructions != "" {
+		out.Messages = append(out.Messages, chatMessage{Role: "system", Content: textContent(in.Instructions)})
+	}
+	messages, err := chatMessages(in.Input)
+	if err != nil {
+		return nil, nil, err
+	}
+	out.Messages = append(out.Messages, messages...)
+
+	// tools, built-in ones like web_search have no chat equivalent
+	for _, t := range in.Tools {
+		if t.Type != "function" {
+			continue
+		}
+		out.Tools = append(out.Tools, chatTool{
+			Type:     "function",
+			Function: chatFunction{Name: t.Name, Description: t.Description, Parameters: t.Parameters, Strict: t.Strict},
+		})
+	}
+	if len(in.ToolChoice) > 0 {
+		var named struct {
+			Type string `json:"type"`
+			Name string `json:"name"`
+		}
+		if json.Unmarshal(in.ToolChoice, &named) == nil && named.Name != "" {
+			out.ToolChoice, _ = json.Marshal(map[string]any{"type": "function", "function": map[string]string{"name": named.Name}})
+		} else {
+			out.ToolChoice = in.ToolChoice
+		}
+	}
+
+	data, err := json.Marshal(out)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req := &Request{
+		Path:   strings.TrimSuffix(p, "/responses") + "/chat/completions" + query,
+		Body:   data,
+		Stream: in.Stream,
+	}
+	return req, &responsesConverter{model: in.Model}, nil
+}
+
+// chatMessages converts responses input into chat messages. Function calls
+// are attached to the assistant message before them.
+func chatMessages(input json.RawMessage) ([]chatMessage, error) {
+	var text string
+	if json.Unmarshal(input, &text) == nil {
+		return []chatMessage{{Role: "user", Content: textContent(text)}}, nil
+	}
+
+	var items []responsesItem
+	if err := json.Unmarshal(input, &items); err != nil {
+		return nil, fmt.Errorf("invalid responses input: %w", err)
+	}
+
+	var out []chatMessage
+	for _, it := range items {
+		switch it.Type {
+		case "function_call":
+			call := chatToolCall{ID: it.CallID, Type: "function"}
+			call.Function.Name = it.Name
+			call.Function.Arguments = it.Arguments
+
+			if n := len(out); n > 0 && out[n-1].Role == "assistant" {
+				out[n-1].ToolCalls = append(out[n-1].ToolCalls, call)
+				continue
+			}
+			out = append(out, chatMessage{Role: "assistant", ToolCalls: []chatToolCall{call}})
+
+		case "function_call_output":
+			content, _ := responsesContent(it.Output)
+			out = append(out, chatMessage{Role: "tool", ToolCallID: it.CallID, Content: textContent(content.String())})
+
+		case "", "message":
+			content, err := responsesContent(it.Content)
+			if err != nil {
+				return nil, err
+			}
+			role := it.Role
+			if role == "" {
+				role = "user"
+			}
+			if role == "assistant" {
+				content = textContent(content.String())
+			}
+			out = append(out, chatMessage{Role: role, Content: content})
+		}
+		// reasoning items carry encrypted provider state, there is no chat equivalent
+	}
+	return out, nil
+}
+
+func responsesContent(raw json.RawMessage) (*chatContent, error) {
+	if len(raw) == 0 {
+		return textContent(""), nil
+	}
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return textContent(text), nil
+	}
+
+	var parts []responsesPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return nil, fmt.Errorf("invalid responses content: %w", err)
+	}
+
+	out := &chatContent{Parts: []chatPart{}}
+	for _, p := range parts {
+		switch p.Type {
+		case "input_text", "output_text", "text":
+			out.Parts = append(out.Parts, chatPart{Type: "text", Text: p.Text})
+		case "refusal":
+			out.Parts = append(out.Parts, chatPart{Type: "text", Text: p.Refusal})
+		case "input_image":
+			out.Parts = append(out.Parts, chatPart{Type: "image_url", ImageURL: &chatImageURL{URL: p.ImageURL, Detail: p.Detail}})
+		}
+	}
+	if len(out.Parts) == 1 && out.Parts[0].Type == "text" {
+		return textContent(out.Parts[0].Text), nil
+	}
+	return out, nil
+}
+
+/* --------------------- Response ---------------------- */
+
+type responsesConverter struct {
+	model string
+
+	// stream state
+	started   bool
+	finished  bool
+	seq       int
+	resp      responsesResponse
+	open      map[string]any // message item being streamed, nil when none
+	text      strings.Builder
+	calls     []*streamCall       // function call items being streamed, closed together
+	toolIndex map[int]*streamCall // chat tool call index -> its item
+	finish    string
+	usage     *chatUsage
+}
+
+// streamCall is a function call item kept open while its arguments stream,
+// upstreams may interleave the argument deltas of parallel calls
+type streamCall struct {
+	index int // output index
+	item  map[string]any
+	args  strings.Builder
+}
+
+func (r *responsesConverter) Headers(http.Header) {}
+
+func (r *responsesConverter) Response(body []byte) ([]byte, error) {
+	var in chatResponse
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+
+	out := responsesResponse{
+		ID:        responsesID(in.ID),
+		Object:    "response",
+		CreatedAt: in.Created,
+		Status:    "completed",
+		Model:     orDefault(in.Model, r.model),
+		Output:    []map[string]any{},
+		Usage:     responsesUsageFrom(in.Usage),
+	}
+	if out.CreatedAt == 0 {
+		out.CreatedAt = time.Now().Unix()
+	}
+
+	finish := ""
+	if len(in.Choices) > 0 {
+		choice := in.Choices[0]
+		if msg := choice.Message; msg != nil {
+			if text := msg.Content.String(); text != "" {
+				out.Output = append(out.Output, messageItem(out.ID, 0, text, "completed"))
+			}
+			for _, call := range msg.ToolCalls {
+				out.Output = append(out.Output, functionCallItem(call.ID, call.Function.Name, call.Function.Arguments, "completed"))
+			}
+		}
+		if choice.FinishReason != nil {
+			finish = *choice.FinishReason
+		}
+	}
+	setStatus(&out, finish)
+
+	return json.Marshal(out)
+}
+
+func (r *responsesConverter) Event(_ string, data []byte) []byte {
+	if r.finished {
+		return nil
+	}
+	if bytes.Equal(data, []byte("[DONE]")) {
+		return r.End()
+	}
+
+	var chunk chatResponse
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return nil
+	}
+
+	var b bytes.Buffer
+	if !r.started {
+		r.start(&b, chunk.ID, chunk.Model, chunk.Created)
+	}
+	if chunk.Usage != nil {
+		r.usage = chunk.Usage
+	}
+
+	for _, choice := range chunk.Choices {
+		if d := choice.Delta; d != nil {
+			if text := d.Content.String(); text != "" {
+				if r.open == nil {
+					r.openItem(&b, messageItem(r.resp.ID, len(r.resp.Output), "", "in_progress"))
+					b.Write(r.event("response.content_part.added", map[string]any{
+						"item_id":       r.open["id"],
+						"output_index":  len(r.resp.Output),
+						"content_index": 0,
+						"part":          outputText(""),
+					}))
+				}
+				r.text.WriteString(text)
+				b.Write(r.event("response.output_text.delta", map[string]any{
+					"item_id":       r.open["id"],
+					"output_index":  len(r.resp.Output),
+					"content_index": 0,
+					"delta":         text,
+				}))
+			}
+
+			for _, call := range d.ToolCalls {
+				i := 0
+				if call.Index != nil {
+					i = *call.Index
+				}
+				sc, seen := r.toolIndex[i]
+				if !seen {
+					sc = r.openCall(&b, functionCallItem(call.ID, call.Function.Name, "", "in_progress"))
+					r.toolIndex[i] = sc
+				}
+				// a call closed by a later message cannot take deltas anymore,
+				// chat upstreams send text before tool calls
+				if call.Function.Arguments != "" && sc.item != nil {
+					sc.args.WriteString(call.Function.Arguments)
+					b.Write(r.event("response.function_call_arguments.delta", map[string]any{
+						"item_id":      sc.item["id"],
+						"output_index": sc.index,
+						"delta":        call.Function.Arguments,
+					}))
+				}
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			r.finish = *choice.FinishReason
+		}
+	}
+
+	return b.Bytes()
+}
+
+func (r *responsesConverter) End() []byte {
+	if r.finished {
+		return nil
+	}
+	r.finished = true
+
+	var b bytes.Buffer
+	if !r.started {
+		r.start(&b, "", "", 0)
+	}
+	r.closeItem(&b)
+
+	r.resp.Usage = responsesUsageFrom(r.usage)
+	setStatus(&r.resp, r.finish)
+
+	event := "response.completed"
+	if r.resp.Status == "incomplete" {
+		event = "response.incomplete"
+	}
+	b.Write(r.event(event, map[string]any{"response": r.resp}))
+	return b.Bytes()
+}
+
+func (r *responsesConverter) Error(status int, body []byte) []byte {
+	var e chatError
+	e.Error.Message = errorMessage(body)
+	e.Error.Type = openAIErrorType(status)
+	out, _ := json.Marshal(e)
+	return out
+}
+
+// event formats one stream event, every event carries its type and a sequence number
+func (r *responsesConverter) event(typ string, fields map[string]any) []byte {
+	fields["type"] = typ
+	fields["sequence_number"] = r.seq
+	r.seq++
+	return sseEvent(typ, fields)
+}
+
+func (r *responsesConverter) start(b *bytes.Buffer, id, model string, created int64) {
+	r.started = true
+	r.toolIndex = make(map[int]*streamCall)
+	if created == 0 {
+		created = time.Now().Unix()
+	}
+	r.resp = responsesResponse{
+		ID:        responsesID(id),
+		Object:    "response",
+		CreatedAt: created,
+		Status:    "in_progress",
+		Model:     orDefault(model, r.model),
+		Output:    []map[string]any{},
+	}
+
+	b.Write(r.event("response.created", map[string]any{"response": r.resp}))
+	b.Write(r.event("response.in_progress", map[string]any{"response": r.resp}))
+}
+
+// openItem opens a message item, closing the items before it
+func (r *responsesConverter) openItem(b *bytes.Buffer, item map[string]any) {
+	r.closeItem(b)
+	r.open = item
+	r.text.Reset()
+	b.Write(r.event("response.output_item.added", map[string]any{
+		"output_index": len(r.resp.Output),
+		"item":         item,
+	}))
+}
+
+// openCall opens a function call item next to the calls already open
+func (r *responsesConverter) openCall(b *bytes.Buffer, item map[string]any) *streamCall {
+	r.closeMessage(b)
+	sc := &streamCall{index: len(r.resp.Output) + len(r.calls), item: item}
+	r.calls = append(r.calls, sc)
+	b.Write(r.event("response.output_item.added", map[string]any{
+		"output_index": sc.index,
+		"item":         item,
+	}))
+	return sc
+}
+
+// closeItem finishes every open item and appends them to the response output
+func (r *responsesConverter) closeItem(b *bytes.Buffer) {
+	r.closeMessage(b)
+
+	for _, sc := range r.calls {
+		id := sc.item["id"]
+		args := sc.args.String()
+		item := functionCallItem(sc.item["call_id"].(string), sc.item["name"].(string), args, "completed")
+		b.Write(r.event("response.function_call_arguments.done", map[string]any{
+			"item_id": id, "output_index": sc.index, "arguments": args,
+		}))
+		b.Write(r.event("response.output_item.done", map[string]any{"output_index": sc.index, "item": item}))
+
+		r.resp.Output = append(r.resp.Output, item)
+		sc.item = nil
+	}
+	r.calls = nil
+}
+
+func (r *responsesConverter) closeMessage(b *bytes.Buffer) {
+	if r.open == nil {
+		return
+	}
+	index := len(r.resp.Output)
+	id := r.open["id"]
+	text := r.text.String()
+
+	item := messageItem(r.resp.ID, index, text, "completed")
+	item["id"] = id
+	b.Write(r.event("response.output_text.done", map[string]any{
+		"item_id": id, "output_index": index, "content_index": 0, "text": text,
+	}))
+	b.Write(r.event("response.content_part.done", map[string]any{
+		"item_id": id, "output_index": index, "content_index": 0, "part": outputText(text),
+	}))
+	b.Write(r.event("response.output_item.done", map[string]any{"output_index": index, "item": item}))
+
+	r.resp.Output = append(r.resp.Output, item)
+	r.open = nil
+	r.text.Reset()
+}
+
+func messageItem(respID string, index int, text, status string) map[string]any {
+	content := []any{}
+	if status == "completed" {
+		content = append(content, outputText(text))
+	}
+	return map[string]any{
+		"type":    "message",
+		"id":      fmt.Sprintf("msg_%s_%d", strings.TrimPrefix(respID, "resp_"), index),
+		"status":  status,
+		"role":    "assistant",
+		"content": content,
+	}
+}
+
+func outputText(text string) map[string]any {
+	return map[string]any{"type": "output_text", "text": text, "annotations": []any{}}
+}
+
+func functionCallItem(callID, name, args, status string) map[string]any {
+	if callID == "" {
+		callID = fmt.Sprintf("call_%d", time.Now().UnixNano())
+	}
+	return map[string]any{
+		"type":      "function_call",
+		"id":        "fc_" + strings.TrimPrefix(callID, "call_"),
+		"call_id":   callID,
+		"name":      name,
+		"arguments": args,
+		"status":    status,
+	}
+}
+
+// setStatus marks a response completed, or incomplete when the model ran out of tokens
+func setStatus(resp *responsesResponse, finish string) {
+	switch finish {
+	case "length":
+		resp.Status = "incomplete"
+		resp.IncompleteDetails = map[string]any{"reason": "max_output_tokens"}
+	case "content_filter":
+		resp.Status = "incomplete"
+		resp.IncompleteDetails = map[string]any{"reason": "content_filter"}
+	default:
+		resp.Status = "completed"
+	}
+}
+
+func responsesUsageFrom(u *chatUsage) *responsesUsage {
+	if u == nil {
+		return nil
+	}
+	out := &responsesUsage{
+		InputTokens:  u.PromptTokens,
+		OutputTokens: u.CompletionTokens,
+		TotalTokens:  u.TotalTokens,
+	}
+	out.InputTokensDetails.CachedTokens = u.cached()
+	if d := u.CompletionTokensDetails; d != nil {
+		out.OutputTokensDetails.ReasoningTokens = d.ReasoningTokens
+	}
+	return out
+}
+
+func responsesID(id string) string {
+	if id == "" {
+		return fmt.Sprintf("resp_%d", time.Now().UnixNano())
+	}
+	return "resp_" + strings.TrimPrefix(id, "chatcmpl-")
+}
@@ -0,0 +1,181 @@
+package translate
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestResponsesRequestToChat(t *testing.T) {
+	body := `{
+		"model": "qwen-plus",
+		"instructions": "Be brief.",
+		"max_output_tokens": 512,
+		"stream": true,
+		"text": {"format": {"type": "json_schema", "name": "answer", "schema": {"type": "object"}}},
+		"tools": [
+			{"type": "function", "name": "get_weather", "parameters": {"type": "object"}},
+			{"type": "web_search"}
+		],
+		"tool_choice": {"type": "function", "name": "get_weather"},
+		"input": [
+			{"role": "user", "content": [
+				{"type": "input_text", "text": "Weather here?"},
+				{"type": "input_image", "image_url": "https://example.com/a.png"}
+			]},
+			{"type": "message", "role": "assistant", "content": [{"type": "output_text", "text": "Checking."}]},
+			{"type": "function_call", "call_id": "call_1", "name": "get_weather", "arguments": "{\"city\":\"Paris\"}"},
+			{"type": "function_call_output", "call_id": "call_1", "output": "sunny"},
+			{"role": "user", "content": "Thanks"}
+		]
+	}`
+
+	req, conv, err := responsesToChat("/v1/responses", []byte(body))
+	if err != nil || req == nil || conv == nil {
+		t.Fatalf("expected translation, got req=%v err=%v", req, err)
+	}
+	if req.Path != "/v1/chat/completions" || !req.Stream {
+		t.Fatalf("unexpected upstream request %s stream=%v", req.Path, req.Stream)
+	}
+
+	var out chatRequest
+	if err := json.Unmarshal(req.Body, &out); err != nil {
+		t.Fatal(err)
+	}
+	if *out.MaxTokens != 512 || out.StreamOptions == nil || !out.StreamOptions.IncludeUsage {
+		t.Fatalf("unexpected request fields %s", req.Body)
+	}
+	if out.ResponseFormat == nil || out.ResponseFormat.Type != "json_schema" || out.ResponseFormat.JSONSchema.Name != "answer" {
+		t.Fatalf("unexpected response format %s", req.Body)
+	}
+	if len(out.Tools) != 1 || string(out.ToolChoice) != `{"function":{"name":"get_weather"},"type":"function"}` {
+		t.Fatalf("unexpected tools %s", req.Body)
+	}
+
+	roles := []string{}
+	for _, m := range out.Messages {
+		roles = append(roles, m.Role)
+	}
+	if strings.Join(roles, ",") != "system,user,assistant,tool,user" {
+		t.Fatalf("unexpected message order %v", roles)
+	}
+	if img := out.Messages[1].Content.Parts[1]; img.ImageURL == nil || img.ImageURL.URL != "https://example.com/a.png" {
+		t.Fatalf("unexpected image part %+v", img)
+	}
+	if a := out.Messages[2]; a.Content.String() != "Checking." || a.ToolCalls[0].ID != "call_1" {
+		t.Fatalf("expected the call on the assistant message, got %+v", a)
+	}
+	if tool := out.Messages[3]; tool.ToolCallID != "call_1" || tool.Content.String() != "sunny" {
+		t.Fatalf("unexpected tool output %+v", tool)
+	}
+
+	if _, _, err := responsesToChat("/v1/responses", []byte(`{"model":"m","input":"hi","previous_response_id":"resp_1"}`)); err == nil {
+		t.Fatal("expected previous_response_id to be rejected")
+	}
+	if req, _, _ := responsesToChat("/v1/chat/completions", nil); req != nil {
+		t.Fatal("expected other endpoints to pass through")
+	}
+}
+
+func TestResponsesResponseFromChat(t *testing.T) {
+	_, conv, _ := responsesToChat("/v1/responses", []byte(`{"model":"m","input":"hi"}`))
+
+	out, err := conv.Response([]byte(`{
+		"id": "chatcmpl-1", "created": 1700000000, "model": "qwen-plus",
+		"choices": [{"index": 0, "finish_reason": "tool_calls", "message": {"role": "assistant", "content": "Let me check.",
+			"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{}"}}]}}],
+		"usage": {"prompt_tokens": 20, "completion_tokens": 5, "total_tokens": 25, "prompt_tokens_details": {"cached_tokens": 8}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var resp responsesResponse
+	json.Unmarshal(out, &resp)
+	if resp.ID != "resp_1" || resp.Object != "response" || resp.Status != "completed" || len(resp.Output) != 2 {
+		t.Fatalf("unexpected response %s", out)
+	}
+	if resp.Output[0]["type"] != "message" || resp.Output[1]["call_id"] != "call_1" || resp.Output[1]["name"] != "get_weather" {
+		t.Fatalf("unexpected output %s", out)
+	}
+	if u := resp.Usage; u.InputTokens != 20 || u.OutputTokens != 5 || u.InputTokensDetails.CachedTokens != 8 {
+		t.Fatalf("unexpected usage %s", out)
+	}
+}
+
+func TestResponsesStreamFromChat(t *testing.T) {
+	_, conv, _ := responsesToChat("/v1/responses", []byte(`{"model":"m","stream":true,"input":"hi"}`))
+
+	upstream := strings.Join([]string{
+		`data: {"id":"chatcmpl-1","model":"qwen-plus","choices":[{"index":0,"delta":{"role":"assistant","content":"Hi"},"finish_reason":null}]}`,
+		`data: {"id":"chatcmpl-1","model":"qwen-plus","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]},"finish_reason":null}]}`,
+		`data: {"id":"chatcmpl-1","model":"qwen-plus","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":\"Paris\"}"}}]},"finish_reason":null}]}`,
+		`data: {"id":"chatcmpl-1","model":"qwen-plus","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		`data: {"id":"chatcmpl-1","model":"qwen-plus","choices":[],"usage":{"prompt_tokens":9,"completion_tokens":3,"total_tokens":12}}`,
+		`data: [DONE]`,
+	}, "\n\n") + "\n\n"
+
+	r := NewStreamReader(io.NopCloser(strings.NewReader(upstream)), conv)
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var events []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "event: ") {
+			events = append(events, strings.TrimPrefix(line, "event: "))
+		}
+	}
+	want := strings.Join([]string{
+		"response.created", "response.in_progress",
+		"response.output_item.added", "response.content_part.added", "response.output_text.delta",
+		"response.output_text.done", "response.content_part.done", "response.output_item.done",
+		"response.output_item.added", "response.function_call_arguments.delta",
+		"response.function_call_arguments.done", "response.output_item.done",
+		"response.completed",
+	}, ",")
+	if strings.Join(events, ",") != want {
+		t.Fatalf("unexpected event sequence\n got %s\nwant %s", strings.Join(events, ","), want)
+	}
+	for _, s := range []string{`"delta":"Hi"`, `"arguments":"{\"city\":\"Paris\"}"`, `"input_tokens":9`, `"output_tokens":3`, `"sequence_number":12`} {
+		if !strings.Contains(string(out), s) {
+			t.Errorf("expected stream to contain %s", s)
+		}
+	}
+}
+
+func TestResponsesStreamInterleavedToolCalls(t *testing.T) {
+	_, conv, _ := responsesToChat("/v1/responses", []byte(`{"model":"m","stream":true,"input":"hi"}`))
+
+	upstream := strings.Join([]string{
+		`data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"a","arguments":"{\"x\":"}}]}}]}`,
+		`data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_b","type":"function","function":{"name":"b","arguments":"{\"y\":2}"}}]}}]}`,
+		`data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"1}"}}]},"finish_reason":"tool_calls"}]}`,
+		`data: [DONE]`,
+	}, "\n\n") + "\n\n"
+
+	out, err := io.ReadAll(NewStreamReader(io.NopCloser(strings.NewReader(upstream)), conv))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var completed struct {
+		Response responsesResponse `json:"response"`
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if data, ok := strings.CutPrefix(line, "data: "); ok && strings.Contains(data, `"type":"response.completed"`) {
+			if err := json.Unmarshal([]byte(data), &completed); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	output := completed.Response.Output
+	if len(output) != 2 || output[0]["arguments"] != `{"x":1}` || output[1]["arguments"] != `{"y":2}` {
+		t.Fatalf("expected both calls with their full arguments, got %v", output)
+	}
+	if !strings.Contains(string(out), `"delta":"1}","item_id":"fc_a","output_index":0`) {
+		t.Fatalf("expected the late delta on the first call, got %s", out)
+	}
+}
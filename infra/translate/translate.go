@@ -0,0 +1,143 @@
+package translate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/poixeai/proxify/infra/config"
+)
+
+// Request is a client request rewritten for the upstream protocol
+type Request struct {
+	Path   string // upstream sub path, query included
+	Body   []byte
+	Stream bool
+}
+
+// Converter carries one request's translation state and converts the
+// upstream response back into the client's protocol
+type Converter interface {
+	// Headers adapts auth and protocol headers for the upstream
+	Headers(h http.Header)
+	// Response converts a buffered successful response body
+	Response(body []byte) ([]byte, error)
+	// Event converts one upstream SSE event into client stream bytes
+	Event(event string, data []byte) []byte
+	// End returns what the client still needs once the upstream stream ended
+	End() []byte
+	// Error converts an upstream error body
+	Error(status int, body []byte) []byte
+}
+
+// Protocol translates a client request. It returns a nil Request when the
+// path is not one it handles, such requests are proxied untouched.
+type Protocol func(path string, body []byte) (*Request, Converter, error)
+
+var protocols = map[string]Protocol{
+	config.ProtocolAnthropicToOpenAI: anthropicToOpenAI,
+	config.ProtocolOpenAIToGemini:    openAIToGemini,
+	config.ProtocolResponsesToChat:   responsesToChat,
+}
+
+// For returns the translator of a route protocol, nil for plain proxying
+func For(name string) Protocol {
+	return protocols[name]
+}
+
+// splitPath separates the path from its query, the query keeps its "?"
+func splitPath(p string) (string, string) {
+	if i := strings.IndexByte(p, '?'); i >= 0 {
+		return p[:i], p[i:]
+	}
+	return p, ""
+}
+
+/* --------------------- SSE ---------------------- */
+
+// sseEvent formats one named SSE event
+func sseEvent(event string, v any) []byte {
+	data, _ := json.Marshal(v)
+
+	var b bytes.Buffer
+	if event != "" {
+		b.WriteString("event: ")
+		b.WriteString(event)
+		b.WriteByte('\n')
+	}
+	b.WriteString("data: ")
+	b.Write(data)
+	b.WriteString("\n\n")
+	return b.Bytes()
+}
+
+// streamReader turns an upstream SSE body into the client's stream format
+type streamReader struct {
+	body io.ReadCloser
+	br   *bufio.Reader
+	conv Converter
+
+	event string
+	data  bytes.Buffer
+	out   bytes.Buffer
+	err   error
+}
+
+// NewStreamReader converts an upstream SSE body event by event while it is read
+func NewStreamReader(body io.ReadCloser, conv Converter) io.ReadCloser {
+	return &streamReader{body: body, br: bufio.NewReader(body), conv: conv}
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for r.out.Len() == 0 && r.err == nil {
+		line, err := r.br.ReadBytes('\n')
+		r.line(bytes.TrimRight(line, "\r\n"), len(line) > 0 && line[len(line)-1] == '\n')
+
+		if err != nil {
+			r.dispatch()
+			if err == io.EOF {
+				r.out.Write(r.conv.End())
+			}
+			r.err = err
+		}
+	}
+
+	if r.out.Len() > 0 {
+		return r.out.Read(p)
+	}
+	return 0, r.err
+}
+
+func (r *streamReader) Close() error {
+	return r.body.Close()
+}
+
+func (r *streamReader) line(line []byte, complete bool) {
+	switch {
+	case len(line) == 0:
+		if complete {
+			r.dispatch()
+		}
+	case bytes.HasPrefix(line, []byte(":")):
+		// comment, like keep-alive pings
+	case bytes.HasPrefix(line, []byte("event:")):
+		r.event = string(bytes.TrimSpace(line[len("event:"):]))
+	case bytes.HasPrefix(line, []byte("data:")):
+		if r.data.Len() > 0 {
+			r.data.WriteByte('\n')
+		}
+		r.data.Write(bytes.TrimPrefix(line[len("data:"):], []byte(" ")))
+	}
+}
+
+func (r *streamReader) dispatch() {
+	if r.data.Len() == 0 && r.event == "" {
+		return
+	}
+	r.out.Write(r.conv.Event(r.event, bytes.TrimSpace(r.data.Bytes())))
+	r.event = ""
+	r.data.Reset()
+}
@@ -0,0 +1,114 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrFirstByteTimeout = errors.New("upstream first byte timeout")
+	ErrIdleTimeout      = errors.New("upstream stream idle timeout")
+	ErrTotalTimeout     = errors.New("upstream total request timeout")
+)
+
+// IsTimeout reports whether err is one of the route timeouts
+func IsTimeout(err error) bool {
+	return errors.Is(err, ErrFirstByteTimeout) ||
+		errors.Is(err, ErrIdleTimeout) ||
+		errors.Is(err, ErrTotalTimeout)
+}
+
+// Watchdog enforces the first-byte and idle timeouts of one upstream attempt.
+// It cancels the attempt context when the upstream takes too long to send its
+// first body byte, or when a stream stalls for too long between two chunks.
+type Watchdog struct {
+	ctx       context.Context
+	cancel    context.CancelCauseFunc
+	mu        sync.Mutex // guards timer, armed lazily by the first stream read
+	timer     *time.Timer
+	idle      time.Duration
+	firstSeen atomic.Bool
+}
+
+// NewWatchdog starts the first-byte timer, the returned context must be used
+// for the upstream request. Zero durations disable the matching timeout. The
+// idle timer is only armed by the first byte of a stream, a non-stream
+// completion may take as long as generation does.
+func NewWatchdog(parent context.Context, firstByte, idle time.Duration) (*Watchdog, context.Context) {
+	ctx, cancel := context.WithCancelCause(parent)
+	w := &Watchdog{ctx: ctx, cancel: cancel, idle: idle}
+
+	if firstByte > 0 {
+		w.timer = time.AfterFunc(firstByte, w.fire)
+	}
+	return w, ctx
+}
+
+func (w *Watchdog) fire() {
+	if w.firstSeen.Load() {
+		w.cancel(ErrIdleTimeout)
+	} else {
+		w.cancel(ErrFirstByteTimeout)
+	}
+}
+
+// Body wraps the upstream response body to reset the idle timer on every
+// read, the idle timeout only applies when the body is a stream
+func (w *Watchdog) Body(body io.ReadCloser, stream bool) io.ReadCloser {
+	if !stream {
+		w.idle = 0
+	}
+	return &watchedBody{ReadCloser: body, w: w}
+}
+
+// Err maps an error caused by the watchdog or the total timeout to its cause
+func (w *Watchdog) Err(err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	if cause := context.Cause(w.ctx); IsTimeout(cause) {
+		return cause
+	}
+	return err
+}
+
+// Stop releases the timer and the attempt context
+func (w *Watchdog) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.cancel(context.Canceled)
+}
+
+func (w *Watchdog) seen() {
+	w.firstSeen.Store(true)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch {
+	case w.idle > 0 && w.timer == nil:
+		w.timer = time.AfterFunc(w.idle, w.fire)
+	case w.idle > 0:
+		w.timer.Reset(w.idle)
+	case w.timer != nil:
+		w.timer.Stop()
+	}
+}
+
+type watchedBody struct {
+	io.ReadCloser
+	w *Watchdog
+}
+
+func (b *watchedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.w.seen()
+	}
+	return n, b.w.Err(err)
+}
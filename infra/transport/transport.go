@@ -0,0 +1,139 @@
+package transport
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/poixeai/proxify/infra/config"
+	"github.com/poixeai/proxify/infra/logger"
+)
+
+const (
+	defaultDialTimeout         = 10 * time.Second
+	defaultTLSHandshakeTimeout = 10 * time.Second
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultMaxIdleConnsPerHost = 50
+	defaultKeepAlive           = 30 * time.Second
+)
+
+// Settings are the resolved connection settings of a route
+type Settings struct {
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	MaxIdleConnsPerHost   int
+	HTTP2                 bool
+}
+
+// SettingsFor resolves the transport settings of a route, filling in defaults
+func SettingsFor(route *config.Route) Settings {
+	var cfg config.Transport
+	if route != nil && route.Transport != nil {
+		cfg = *route.Transport
+	}
+
+	s := Settings{
+		DialTimeout:           cfg.DialTimeout.Or(defaultDialTimeout),
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout.Or(defaultTLSHandshakeTimeout),
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout.Std(),
+		IdleConnTimeout:       cfg.IdleConnTimeout.Or(defaultIdleConnTimeout),
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		HTTP2:                 cfg.HTTP2 == nil || *cfg.HTTP2,
+	}
+	if s.MaxIdleConnsPerHost <= 0 {
+		s.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	if route != nil && route.Timeouts != nil && route.Timeouts.Connect > 0 {
+		s.DialTimeout = route.Timeouts.Connect.Std()
+	}
+	return s
+}
+
+func newTransport(s Settings) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   s.DialTimeout,
+		KeepAlive: defaultKeepAlive,
+	}
+
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		DisableCompression:    true, // disable gzip, avoid stream cache
+		ForceAttemptHTTP2:     s.HTTP2,
+		TLSHandshakeTimeout:   s.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: s.ResponseHeaderTimeout,
+		IdleConnTimeout:       s.IdleConnTimeout,
+		MaxIdleConnsPerHost:   s.MaxIdleConnsPerHost,
+		ExpectContinueTimeout: time.Second,
+	}
+	if !s.HTTP2 {
+		// a non-nil empty map disables the automatic HTTP/2 upgrade
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return t
+}
+
+/* --------------------- Registry ---------------------- */
+
+type entry struct {
+	settings Settings
+	client   *http.Client
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]*entry) // route path -> client
+)
+
+// Client returns the shared upstream client of a route. Connections are kept
+// alive across requests; the transport is only rebuilt when the route's
+// settings change after a hot reload.
+func Client(route *config.Route) *http.Client {
+	key := ""
+	if route != nil {
+		key = route.Path
+	}
+	s := SettingsFor(route)
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if e, ok := registry[key]; ok {
+		if e.settings == s {
+			return e.client
+		}
+
+		// settings changed, drop the old pool once in-flight requests finish
+		e.client.CloseIdleConnections()
+		logger.Infof("[Transport] route=%s settings changed, transport rebuilt", key)
+	}
+
+	client := &http.Client{
+		Timeout:   0, // no timeout, let ctx control it
+		Transport: newTransport(s),
+	}
+	registry[key] = &entry{settings: s, client: client}
+	return client
+}
+
+// Prune closes and forgets the transports of routes that no longer exist
+func Prune(cfg *config.RoutesConfig) {
+	active := make(map[string]bool, len(cfg.Routes))
+	for _, r := range cfg.Routes {
+		active[r.Path] = true
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for key, e := range registry {
+		if key != "" && !active[key] {
+			e.client.CloseIdleConnections()
+			delete(registry, key)
+		}
+	}
+}
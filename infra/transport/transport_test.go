@@ -0,0 +1,43 @@
+package transport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/poixeai/proxify/infra/config"
+)
+
+func TestClientIsReusedUntilSettingsChange(t *testing.T) {
+	route := &config.Route{Path: "/reuse", Target: "https://api.openai.com"}
+
+	c1 := Client(route)
+	if Client(route) != c1 {
+		t.Fatal("expected client to be shared across requests")
+	}
+
+	// a hot reload yields a new route value with the same settings
+	reloaded := *route
+	if Client(&reloaded) != c1 {
+		t.Fatal("expected client to survive a reload without setting changes")
+	}
+
+	disabled := false
+	reloaded.Transport = &config.Transport{
+		DialTimeout: config.Duration(2 * time.Second),
+		HTTP2:       &disabled,
+	}
+	c2 := Client(&reloaded)
+	if c2 == c1 {
+		t.Fatal("expected client to be rebuilt after settings changed")
+	}
+
+	s := SettingsFor(&reloaded)
+	if s.DialTimeout != 2*time.Second || s.HTTP2 || s.MaxIdleConnsPerHost != defaultMaxIdleConnsPerHost {
+		t.Fatalf("unexpected settings %+v", s)
+	}
+
+	Prune(&config.RoutesConfig{})
+	if Client(&reloaded) == c2 {
+		t.Fatal("expected pruned route to get a fresh client")
+	}
+}
@@ -0,0 +1,140 @@
+package usage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	// larger buffered bodies are passed through without accounting
+	maxBufferedBody = 8 << 20
+	// larger stream lines are skipped
+	maxStreamLine = 1 << 20
+)
+
+// Tap wraps an upstream response body and extracts usage from what the
+// client reads. Bytes are handed on as soon as they arrive, parsing happens
+// on the side so streams are never delayed.
+type Tap struct {
+	body     io.ReadCloser
+	stream   bool
+	encoding string
+
+	mu       sync.Mutex
+	buf      []byte // whole body when buffered, the current line when streaming
+	overflow bool
+	acc      Usage
+}
+
+// NewTap wraps resp.Body, stream selects line-by-line (SSE / NDJSON) parsing
+func NewTap(resp *http.Response, stream bool) *Tap {
+	return &Tap{
+		body:     resp.Body,
+		stream:   stream,
+		encoding: strings.ToLower(resp.Header.Get("Content-Encoding")),
+	}
+}
+
+func (t *Tap) Read(p []byte) (int, error) {
+	n, err := t.body.Read(p)
+	if n > 0 {
+		t.mu.Lock()
+		t.write(p[:n])
+		t.mu.Unlock()
+	}
+	return n, err
+}
+
+func (t *Tap) Close() error {
+	return t.body.Close()
+}
+
+func (t *Tap) write(p []byte) {
+	if !t.stream {
+		if t.overflow || len(t.buf)+len(p) > maxBufferedBody {
+			t.overflow = true
+			t.buf = nil
+			return
+		}
+		t.buf = append(t.buf, p...)
+		return
+	}
+
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			t.appendLine(p)
+			return
+		}
+		t.appendLine(p[:i])
+		t.line()
+		p = p[i+1:]
+	}
+}
+
+func (t *Tap) appendLine(p []byte) {
+	if t.overflow {
+		return
+	}
+	if len(t.buf)+len(p) > maxStreamLine {
+		t.overflow = true
+		t.buf = t.buf[:0]
+		return
+	}
+	t.buf = append(t.buf, p...)
+}
+
+// line parses the completed stream line, SSE "data:" lines and bare NDJSON alike
+func (t *Tap) line() {
+	data := bytes.TrimSpace(t.buf)
+	skip := t.overflow
+	t.buf = t.buf[:0]
+	t.overflow = false
+	if skip {
+		return
+	}
+
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("data:")))
+	if len(data) == 0 || data[0] != '{' {
+		return
+	}
+	// only events that carry usage are worth decoding
+	if !bytes.Contains(data, []byte(`"usage`)) {
+		return
+	}
+	t.acc.merge(data)
+}
+
+// Usage returns what was extracted so far, or nil when the response carried
+// no usage. Call it after the body has been read.
+func (t *Tap) Usage() *Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.stream {
+		if len(t.buf) > 0 {
+			t.line()
+		}
+		return t.acc.result()
+	}
+
+	if t.overflow {
+		return nil
+	}
+	body := t.buf
+	if t.encoding == "gzip" {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil
+		}
+		body, err = io.ReadAll(io.LimitReader(zr, maxBufferedBody))
+		if err != nil {
+			return nil
+		}
+	}
+	return Parse(body)
+}
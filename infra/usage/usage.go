@@ -0,0 +1,158 @@
+package usage
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Usage is the token accounting of one upstream response, normalized across
+// providers. PromptTokens includes cached prompt tokens.
+type Usage struct {
+	Model            string `json:"model,omitempty"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	CachedTokens     int    `json:"cached_tokens"`
+	TotalTokens      int    `json:"total_tokens"`
+}
+
+// payload holds every field the supported providers report usage in
+type payload struct {
+	Model         string       `json:"model"`
+	ModelVersion  string       `json:"modelVersion"` // gemini
+	Usage         *rawUsage    `json:"usage"`
+	UsageMetadata *geminiUsage `json:"usageMetadata"`
+
+	Message  *payload `json:"message"`  // anthropic message_start
+	Response *payload `json:"response"` // openai responses stream events
+}
+
+type rawUsage struct {
+	// openai chat completions
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	TotalTokens         int `json:"total_tokens"`
+	PromptTokensDetails *struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+
+	// openai responses and anthropic messages
+	InputTokens        int `json:"input_tokens"`
+	OutputTokens       int `json:"output_tokens"`
+	InputTokensDetails *struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"input_tokens_details"`
+
+	// anthropic, input_tokens excludes both
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+}
+
+type geminiUsage struct {
+	PromptTokenCount        int `json:"promptTokenCount"`
+	CandidatesTokenCount    int `json:"candidatesTokenCount"`
+	ThoughtsTokenCount      int `json:"thoughtsTokenCount"`
+	CachedContentTokenCount int `json:"cachedContentTokenCount"`
+	TotalTokenCount         int `json:"totalTokenCount"`
+}
+
+// Parse extracts usage from a buffered JSON response body. Gemini's
+// non-SSE streaming returns a JSON array of chunks, the last usage wins.
+func Parse(body []byte) *Usage {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil
+	}
+
+	u := &Usage{}
+	if body[0] == '[' {
+		var list []json.RawMessage
+		if err := json.Unmarshal(body, &list); err != nil {
+			return nil
+		}
+		for _, item := range list {
+			u.merge(item)
+		}
+	} else {
+		u.merge(body)
+	}
+
+	return u.result()
+}
+
+// merge folds one JSON object into u, non-zero values win so partial stream
+// events (like anthropic's message_delta) only update what they carry
+func (u *Usage) merge(data []byte) {
+	var p payload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return
+	}
+
+	switch {
+	case p.Message != nil:
+		u.apply(p.Message)
+	case p.Response != nil:
+		u.apply(p.Response)
+	}
+	u.apply(&p)
+}
+
+func (u *Usage) apply(p *payload) {
+	set(&u.Model, p.Model)
+	set(&u.Model, p.ModelVersion)
+
+	if r := p.Usage; r != nil {
+		cached := r.CacheReadInputTokens
+		if r.PromptTokensDetails != nil {
+			cached += r.PromptTokensDetails.CachedTokens
+		}
+		if r.InputTokensDetails != nil {
+			cached += r.InputTokensDetails.CachedTokens
+		}
+
+		prompt := r.PromptTokens
+		if prompt == 0 {
+			prompt = r.InputTokens + r.CacheReadInputTokens + r.CacheCreationInputTokens
+		}
+		completion := r.CompletionTokens
+		if completion == 0 {
+			completion = r.OutputTokens
+		}
+
+		setInt(&u.PromptTokens, prompt)
+		setInt(&u.CompletionTokens, completion)
+		setInt(&u.CachedTokens, cached)
+		setInt(&u.TotalTokens, r.TotalTokens)
+	}
+
+	if g := p.UsageMetadata; g != nil {
+		setInt(&u.PromptTokens, g.PromptTokenCount)
+		setInt(&u.CompletionTokens, g.CandidatesTokenCount+g.ThoughtsTokenCount)
+		setInt(&u.CachedTokens, g.CachedContentTokenCount)
+		setInt(&u.TotalTokens, g.TotalTokenCount)
+	}
+}
+
+// result returns nil when nothing was found, and fills in a missing total
+func (u *Usage) result() *Usage {
+	if u.PromptTokens == 0 && u.CompletionTokens == 0 && u.TotalTokens == 0 {
+		return nil
+	}
+
+	out := *u
+	if out.TotalTokens < out.PromptTokens+out.CompletionTokens {
+		out.TotalTokens = out.PromptTokens + out.CompletionTokens
+	}
+	return &out
+}
+
+func set(dst *string, v string) {
+	if v != "" {
+		*dst = v
+	}
+}
+
+func setInt(dst *int, v int) {
+	if v != 0 {
+		*dst = v
+	}
+}
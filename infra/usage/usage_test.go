@@ -0,0 +1,103 @@
+package usage
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestParseBufferedBodies(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		want Usage
+	}{
+		{
+			name: "openai chat",
+			body: `{"model":"gpt-4o","usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15,"prompt_tokens_details":{"cached_tokens":4}}}`,
+			want: Usage{Model: "gpt-4o", PromptTokens: 10, CompletionTokens: 5, CachedTokens: 4, TotalTokens: 15},
+		},
+		{
+			name: "openai responses",
+			body: `{"model":"gpt-4.1","usage":{"input_tokens":7,"output_tokens":3,"total_tokens":10,"input_tokens_details":{"cached_tokens":2}}}`,
+			want: Usage{Model: "gpt-4.1", PromptTokens: 7, CompletionTokens: 3, CachedTokens: 2, TotalTokens: 10},
+		},
+		{
+			name: "anthropic messages",
+			body: `{"model":"claude-sonnet-4","usage":{"input_tokens":5,"cache_read_input_tokens":20,"cache_creation_input_tokens":1,"output_tokens":8}}`,
+			want: Usage{Model: "claude-sonnet-4", PromptTokens: 26, CompletionTokens: 8, CachedTokens: 20, TotalTokens: 34},
+		},
+		{
+			name: "gemini array",
+			body: `[{"modelVersion":"gemini-2.5-pro","usageMetadata":{"promptTokenCount":3}},{"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":4,"thoughtsTokenCount":2,"totalTokenCount":9}}]`,
+			want: Usage{Model: "gemini-2.5-pro", PromptTokens: 3, CompletionTokens: 6, TotalTokens: 9},
+		},
+	}
+
+	for _, tc := range cases {
+		got := Parse([]byte(tc.body))
+		if got == nil || *got != tc.want {
+			t.Errorf("%s: expected %+v, got %+v", tc.name, tc.want, got)
+		}
+	}
+
+	if got := Parse([]byte(`{"id":"x"}`)); got != nil {
+		t.Fatalf("expected nil usage for body without usage, got %+v", got)
+	}
+}
+
+func TestTapExtractsFromSplitStreams(t *testing.T) {
+	cases := []struct {
+		name   string
+		stream string
+		want   Usage
+	}{
+		{
+			name: "anthropic",
+			stream: "event: message_start\n" +
+				`data: {"type":"message_start","message":{"model":"claude-sonnet-4","usage":{"input_tokens":12,"output_tokens":1}}}` + "\n\n" +
+				"event: content_block_delta\n" +
+				`data: {"type":"content_block_delta","delta":{"type":"text_delta","text":"hi"}}` + "\n\n" +
+				"event: message_delta\n" +
+				`data: {"type":"message_delta","usage":{"output_tokens":30}}` + "\n\n",
+			want: Usage{Model: "claude-sonnet-4", PromptTokens: 12, CompletionTokens: 30, TotalTokens: 42},
+		},
+		{
+			name: "openai chat",
+			stream: `data: {"model":"gpt-4o","choices":[{"delta":{"content":"hi"}}],"usage":null}` + "\n\n" +
+				`data: {"model":"gpt-4o","choices":[],"usage":{"prompt_tokens":9,"completion_tokens":2,"total_tokens":11}}` + "\n\n" +
+				"data: [DONE]\n\n",
+			want: Usage{Model: "gpt-4o", PromptTokens: 9, CompletionTokens: 2, TotalTokens: 11},
+		},
+		{
+			name: "openai responses",
+			stream: "event: response.completed\n" +
+				`data: {"type":"response.completed","response":{"model":"gpt-4.1","usage":{"input_tokens":4,"output_tokens":6,"total_tokens":10}}}` + "\n\n",
+			want: Usage{Model: "gpt-4.1", PromptTokens: 4, CompletionTokens: 6, TotalTokens: 10},
+		},
+	}
+
+	for _, tc := range cases {
+		resp := &http.Response{Header: http.Header{}, Body: io.NopCloser(bytes.NewReader([]byte(tc.stream)))}
+		tap := NewTap(resp, true)
+
+		// tiny reads split every event across chunk boundaries
+		var out bytes.Buffer
+		buf := make([]byte, 7)
+		for {
+			n, err := tap.Read(buf)
+			out.Write(buf[:n])
+			if err != nil {
+				break
+			}
+		}
+
+		if out.String() != tc.stream {
+			t.Fatalf("%s: expected stream to pass through unchanged", tc.name)
+		}
+		if got := tap.Usage(); got == nil || *got != tc.want {
+			t.Errorf("%s: expected %+v, got %+v", tc.name, tc.want, got)
+		}
+	}
+}
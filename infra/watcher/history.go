@@ -0,0 +1,254 @@
+package watcher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/poixeai/proxify/infra/config"
+	"github.com/poixeai/proxify/infra/transport"
+)
+
+const (
+	HistorySizeEnv     = "CONFIG_HISTORY_SIZE"
+	defaultHistorySize = 20
+)
+
+// sources of a config version
+const (
+	SourceStartup  = "startup"
+	SourceFile     = "file"     // hot reload of the config file
+	SourceAdmin    = "admin"    // admin api change
+	SourceRollback = "rollback" // rollback to an earlier version
+)
+
+// ErrVersionNotFound is returned for versions that were never kept or already dropped
+var ErrVersionNotFound = errors.New("config version not found")
+
+// Version is one routes config that was served
+type Version struct {
+	ID     int       `json:"id"`
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	Hash   string    `json:"hash"` // sha256 of the config json
+	Routes int       `json:"routes"`
+
+	config *config.RoutesConfig
+}
+
+// Config returns the routes config of the version
+func (v Version) Config() *config.RoutesConfig {
+	return v.config
+}
+
+var (
+	historyMu sync.Mutex
+	history   []Version // oldest first
+	nextID    = 1
+)
+
+// apply serves cfg and records it as a new version. A config identical to
+// the current one, like the file event following an admin write, is served
+// without adding a version.
+func apply(cfg *config.RoutesConfig, source string) {
+	hash := configHash(cfg)
+
+	ConfigValue.Store(cfg)
+	transport.Prune(cfg)
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	if n := len(history); n > 0 && history[n-1].Hash == hash {
+		return
+	}
+
+	history = append(history, Version{
+		ID:     nextID,
+		Time:   time.Now(),
+		Source: source,
+		Hash:   hash,
+		Routes: len(cfg.Routes),
+		config: cfg,
+	})
+	nextID++
+
+	if max := historySize(); len(history) > max {
+		history = append([]Version(nil), history[len(history)-max:]...)
+	}
+}
+
+func historySize() int {
+	if n, err := strconv.Atoi(os.Getenv(HistorySizeEnv)); err == nil && n > 0 {
+		return n
+	}
+	return defaultHistorySize
+}
+
+func configHash(cfg *config.RoutesConfig) string {
+	data, _ := json.Marshal(cfg)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Versions returns the kept versions, newest first
+func Versions() []Version {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	list := make([]Version, len(history))
+	for i, v := range history {
+		list[len(history)-1-i] = v
+	}
+	return list
+}
+
+// GetVersion returns a kept version, id 0 means the current one
+func GetVersion(id int) (Version, error) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	if id == 0 && len(history) > 0 {
+		return history[len(history)-1], nil
+	}
+	for _, v := range history {
+		if v.ID == id {
+			return v, nil
+		}
+	}
+	return Version{}, ErrVersionNotFound
+}
+
+// Rollback serves an earlier version again, written back like an admin change
+func Rollback(id int) (*config.RoutesConfig, bool, error) {
+	v, err := GetVersion(id)
+	if err != nil {
+		return nil, false, err
+	}
+	return update(SourceRollback, func(cfg *config.RoutesConfig) error {
+		// a deep copy, the served config must never share slices or maps
+		// with the stored version
+		restored, err := clone(v.config)
+		if err != nil {
+			return err
+		}
+		*cfg = *restored
+		return nil
+	})
+}
+
+/* --------------------- Diff ---------------------- */
+
+// FieldChange is one changed setting, From or To is nil when it was added or removed
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+type RouteDiff struct {
+	Path    string        `json:"path"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// Diff is the structured difference between two versions
+type Diff struct {
+	From      int           `json:"from"`
+	To        int           `json:"to"`
+	Added     []string      `json:"added"`     // route paths only in To
+	Removed   []string      `json:"removed"`   // route paths only in From
+	Changed   []RouteDiff   `json:"changed"`   // routes in both with other settings
+	Reordered bool          `json:"reordered"` // routes kept in both changed order
+	Settings  []FieldChange `json:"settings"`  // top-level settings besides routes
+}
+
+// DiffVersions compares two kept versions, id 0 means the current one
+func DiffVersions(fromID, toID int) (*Diff, error) {
+	from, err := GetVersion(fromID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := GetVersion(toID)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Diff{
+		From:     from.ID,
+		To:       to.ID,
+		Added:    []string{},
+		Removed:  []string{},
+		Changed:  []RouteDiff{},
+		Settings: []FieldChange{},
+	}
+
+	var kept []string
+	for _, r := range from.config.Routes {
+		other := to.config.RouteByPath(r.Path)
+		if other == nil {
+			d.Removed = append(d.Removed, r.Path)
+			continue
+		}
+		kept = append(kept, r.Path)
+		if changes := diffFields(toMap(r), toMap(*other)); len(changes) > 0 {
+			d.Changed = append(d.Changed, RouteDiff{Path: r.Path, Changes: changes})
+		}
+	}
+
+	var keptTo []string
+	for _, r := range to.config.Routes {
+		if from.config.RouteByPath(r.Path) == nil {
+			d.Added = append(d.Added, r.Path)
+			continue
+		}
+		keptTo = append(keptTo, r.Path)
+	}
+	d.Reordered = !reflect.DeepEqual(kept, keptTo)
+
+	fromTop, toTop := toMap(from.config), toMap(to.config)
+	delete(fromTop, "routes")
+	delete(toTop, "routes")
+	d.Settings = append(d.Settings, diffFields(fromTop, toTop)...)
+
+	return d, nil
+}
+
+// toMap turns a config value into its json fields, so the diff names fields
+// the way the config file does
+func toMap(v any) map[string]any {
+	data, _ := json.Marshal(v)
+	m := make(map[string]any)
+	json.Unmarshal(data, &m)
+	return m
+}
+
+func diffFields(from, to map[string]any) []FieldChange {
+	keys := make(map[string]bool)
+	for k := range from {
+		keys[k] = true
+	}
+	for k := range to {
+		keys[k] = true
+	}
+
+	names := make([]string, 0, len(keys))
+	for k := range keys {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var changes []FieldChange
+	for _, k := range names {
+		if !reflect.DeepEqual(from[k], to[k]) {
+			changes = append(changes, FieldChange{Field: k, From: from[k], To: to[k]})
+		}
+	}
+	return changes
+}
@@ -1,18 +1,33 @@
 package watcher
 
 import (
-	"errors"
 	"fmt"
+	"maps"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/poixeai/proxify/infra/config"
 	"github.com/poixeai/proxify/infra/logger"
+	"github.com/poixeai/proxify/infra/metrics"
+	"github.com/poixeai/proxify/infra/modelpolicy"
 )
 
 var ConfigValue atomic.Value // global config value
 
+// reloadDelay batches the burst of events of one change, like the remove and
+// create of an atomic write or several files dropped into a config directory
+const reloadDelay = 100 * time.Millisecond
+
+// WatchJSON reloads the routes config when file changes. When file is a
+// directory, creating, changing, removing or renaming any config file in it
+// reloads the merged config.
 func WatchJSON(file string) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
@@ -20,31 +35,84 @@ func WatchJSON(file string) {
 		return
 	}
 
+	dirMode := isDir(file)
+	var (
+		mu    sync.Mutex
+		timer *time.Timer
+	)
+	schedule := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if timer != nil {
+			timer.Stop()
+		}
+		timer = time.AfterFunc(reloadDelay, func() { reloadFile(file) })
+	}
+
 	go func() {
 		for event := range watcher.Events {
-			if event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
-				cfg, err := config.LoadRoutesConfig(file)
-				if err != nil {
-					logger.Errorf("[%s] file reload failed: %v", file, err)
-					continue
+			if dirMode {
+				// removed and renamed files drop out of the merged config too
+				if filepath.Dir(filepath.Clean(event.Name)) == filepath.Clean(file) && config.IsConfigFile(event.Name) &&
+					event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 {
+					schedule()
 				}
-
-				if err := validateRoutes(cfg); err != nil {
-					logger.Errorf("[%s] validation failed: %v", file, err)
-					continue
-				}
-
-				ConfigValue.Store(cfg)
-				logger.Infof("[%s] file reloaded successfully.", file)
+				continue
+			}
+			if filepath.Clean(event.Name) != filepath.Clean(file) {
+				continue
+			}
+			// atomic writes rename a temp file over the config
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				schedule()
 			}
 		}
 	}()
 
-	if err := watcher.Add(file); err != nil {
+	// watch the directory, a watch on the file itself is lost once it is replaced
+	dir := filepath.Dir(file)
+	if dirMode {
+		dir = file
+	}
+	if err := watcher.Add(dir); err != nil {
 		logger.Warnf("watcher: file [%s] not found, skip watching", file)
 	}
 }
 
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func reloadFile(file string) {
+	// admin updates write the file, let them finish so the reload sees their content
+	updateMu.Lock()
+	defer updateMu.Unlock()
+
+	cfg, err := config.LoadRoutesConfig(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// renamed away, the replacement arrives as a create
+			return
+		}
+		// the error names the file and, for config mistakes, the field and line
+		logger.Errorf("routes reload failed: %v", err)
+		metrics.ConfigReloads.Inc("failure")
+		return
+	}
+
+	if err := validateRoutes(cfg); err != nil {
+		source := config.RoutesConfigSource{Type: config.RoutesConfigSourceFile, Path: file}
+		logger.Errorf("routes validation failed: %v", source.Locate(err))
+		metrics.ConfigReloads.Inc("failure")
+		return
+	}
+
+	apply(cfg, SourceFile)
+	metrics.ConfigReloads.Inc("success")
+	logger.Infof("[%s] file reloaded successfully.", file)
+}
+
 func InitRoutesWatcher() error {
 	source := config.ResolveRoutesConfigSource()
 
@@ -69,11 +137,13 @@ func InitRoutesWatcher() error {
 
 	// validate routes
 	if err := validateRoutes(cfg); err != nil {
+		err = source.Locate(err)
 		logger.Errorf("route validation failed: %v", err)
 		return err
 	}
 
-	ConfigValue.Store(cfg)
+	apply(cfg, SourceStartup)
+	configSource = source
 	if source.SupportsWatch() {
 		WatchJSON(source.Path)
 	} else {
@@ -91,26 +161,261 @@ func GetRoutes() *config.RoutesConfig {
 	return v.(*config.RoutesConfig)
 }
 
+// validateRoutes checks a decoded config, errors are *config.FieldError
+// with the path of the offending field
 func validateRoutes(cfg *config.RoutesConfig) error {
 	seen := make(map[string]bool)
-	for _, r := range cfg.Routes {
+	for i, r := range cfg.Routes {
 		path := r.Path
+		at := func(field string) string {
+			return config.JoinPath(config.JoinPath("routes", i), field)
+		}
 
-		// 1. check empty
+		// 1. check path, a single segment like /openai
 		if path == "" {
-			return errors.New("invalid route: empty path is not allowed")
+			return config.FieldErrorf(at("path"), "is required")
+		}
+		if !validTopPath(path) {
+			return config.FieldErrorf(at("path"), "'%s' must be a single segment like /openai", path)
 		}
 
 		// 2. check reserved
-		if config.ReservedTopRoutes[path] {
-			return fmt.Errorf("invalid route: path '%s' is reserved by system", path)
+		if config.ReservedTopRoutes[strings.TrimPrefix(path, "/")] {
+			return config.FieldErrorf(at("path"), "'%s' is reserved by system", path)
 		}
 
 		// 3. check duplicate
 		if seen[path] {
-			return fmt.Errorf("invalid route: duplicate path '%s'", path)
+			return config.FieldErrorf(at("path"), "duplicate path '%s'", path)
 		}
 		seen[path] = true
+
+		// 4. check targets
+		if r.Target == "" && len(r.Targets) == 0 {
+			return config.FieldErrorf(at("target"), "route '%s' needs a target or targets", path)
+		}
+		if r.Target != "" {
+			if err := validateURL(r.Target); err != nil {
+				return config.FieldErrorf(at("target"), "%v", err)
+			}
+		}
+		for j, t := range r.Targets {
+			target := config.JoinPath(at("targets"), j)
+			if t.URL == "" {
+				return config.FieldErrorf(config.JoinPath(target, "url"), "is required")
+			}
+			if err := validateURL(t.URL); err != nil {
+				return config.FieldErrorf(config.JoinPath(target, "url"), "%v", err)
+			}
+			if t.Weight < 0 {
+				return config.FieldErrorf(config.JoinPath(target, "weight"), "must not be negative")
+			}
+		}
+
+		// 5. check failover
+		if r.Failover != nil {
+			if r.Failover.MaxAttempts < 0 {
+				return config.FieldErrorf(at("failover.max_attempts"), "must not be negative")
+			}
+			for j, code := range r.Failover.StatusCodes {
+				if code < 100 || code > 599 {
+					return config.FieldErrorf(config.JoinPath(at("failover.status_codes"), j), "invalid status code %d", code)
+				}
+			}
+		}
+
+		// 6. check health check
+		if hc := r.HealthCheck; hc != nil {
+			if hc.Path != "" && !strings.HasPrefix(hc.Path, "/") {
+				return config.FieldErrorf(at("health_check.path"), "must start with '/'")
+			}
+			if hc.ExpectedStatus != 0 && (hc.ExpectedStatus < 100 || hc.ExpectedStatus > 599) {
+				return config.FieldErrorf(at("health_check.expected_status"), "invalid status code %d", hc.ExpectedStatus)
+			}
+			if hc.Interval < 0 || hc.Timeout < 0 || hc.UnhealthyThreshold < 0 || hc.HealthyThreshold < 0 {
+				return config.FieldErrorf(at("health_check"), "values must not be negative")
+			}
+		}
+
+		// 7. check circuit breaker
+		if cb := r.CircuitBreaker; cb != nil {
+			if cb.ErrorRateThreshold < 0 || cb.ErrorRateThreshold > 1 || cb.SlowCallRateThreshold < 0 || cb.SlowCallRateThreshold > 1 {
+				return config.FieldErrorf(at("circuit_breaker"), "rate thresholds must be between 0 and 1")
+			}
+			if cb.Window < 0 || cb.OpenDuration < 0 || cb.SlowCallDuration < 0 || cb.MinRequests < 0 || cb.HalfOpenRequests < 0 {
+				return config.FieldErrorf(at("circuit_breaker"), "values must not be negative")
+			}
+		}
+
+		// 8. check transport
+		if tr := r.Transport; tr != nil {
+			if tr.DialTimeout < 0 || tr.TLSHandshakeTimeout < 0 || tr.ResponseHeaderTimeout < 0 || tr.IdleConnTimeout < 0 || tr.MaxIdleConnsPerHost < 0 {
+				return config.FieldErrorf(at("transport"), "values must not be negative")
+			}
+		}
+
+		// 9. check timeouts
+		if to := r.Timeouts; to != nil {
+			if to.Connect < 0 || to.FirstByte < 0 || to.Idle < 0 || to.Total < 0 {
+				return config.FieldErrorf(at("timeouts"), "values must not be negative")
+			}
+		}
+
+		// 10. check credentials
+		creds := map[string]*config.Credential{at("credential"): r.Credential}
+		for j, t := range r.Targets {
+			creds[config.JoinPath(config.JoinPath(at("targets"), j), "credential")] = t.Credential
+		}
+		for _, field := range slices.Sorted(maps.Keys(creds)) {
+			cred := creds[field]
+			if cred == nil {
+				continue
+			}
+			switch cred.Type {
+			case "", config.CredentialTypeBearer, config.CredentialTypeAnthropic, config.CredentialTypeAzure, config.CredentialTypeGemini:
+			default:
+				return config.FieldErrorf(config.JoinPath(field, "type"), "unknown credential type '%s'", cred.Type)
+			}
+			if (cred.Env == "") == (cred.File == "") {
+				return config.FieldErrorf(field, "needs exactly one of env or file")
+			}
+		}
+
+		// 11. check rate limits
+		for j, rl := range r.RateLimits {
+			field := config.JoinPath(at("rate_limits"), j)
+			if (rl.Requests > 0) == (rl.Tokens > 0) || rl.Requests < 0 || rl.Tokens < 0 {
+				return config.FieldErrorf(field, "needs a positive requests or tokens, not both")
+			}
+			if rl.Per < 0 || rl.Burst < 0 {
+				return config.FieldErrorf(field, "per and burst must not be negative")
+			}
+			switch rl.Key {
+			case "", config.RateLimitKeyIP, config.RateLimitKeyToken, config.RateLimitKeyRoute:
+			default:
+				return config.FieldErrorf(config.JoinPath(field, "key"), "unknown key '%s'", rl.Key)
+			}
+		}
+
+		// 12. check quota
+		if q := r.Quota; q != nil {
+			if q.Daily < 0 || q.Monthly < 0 {
+				return config.FieldErrorf(at("quota"), "limits must be non-negative")
+			}
+			if q.Daily == 0 && q.Monthly == 0 {
+				return config.FieldErrorf(at("quota"), "needs a daily or monthly limit")
+			}
+		}
+
+		// 13. check prices
+		if err := validatePrices(at("prices"), r.Prices); err != nil {
+			return err
+		}
+
+		// 14. check protocol
+		switch r.Protocol {
+		case "", config.ProtocolAnthropicToOpenAI, config.ProtocolOpenAIToGemini, config.ProtocolResponsesToChat:
+		default:
+			return config.FieldErrorf(at("protocol"), "unknown protocol '%s'", r.Protocol)
+		}
+
+		// 15. check load balance strategy
+		switch r.LoadBalance {
+		case "", config.LoadBalanceWeightedRoundRobin, config.LoadBalanceLeastRequests, config.LoadBalanceRandom:
+		default:
+			return config.FieldErrorf(at("load_balance"), "unknown load_balance '%s'", r.LoadBalance)
+		}
+
+		// 16. check model catalog
+		for j, m := range r.Models {
+			if m == "" {
+				return config.FieldErrorf(config.JoinPath(at("models"), j), "is empty")
+			}
+		}
+		if r.ModelsEndpoint != "" && !strings.HasPrefix(r.ModelsEndpoint, "/") {
+			return config.FieldErrorf(at("models_endpoint"), "must start with '/'")
+		}
+
+		// 17. check model policy
+		if _, err := modelpolicy.Compile(&r); err != nil {
+			return config.FieldErrorf(at("model_policy"), "%v", err)
+		}
+
+		// 18. check model map
+		for _, from := range slices.Sorted(maps.Keys(r.ModelMap)) {
+			if from == "" {
+				return config.FieldErrorf(at("model_map"), "has an empty model name")
+			}
+			if r.ModelMap[from] == "" {
+				return config.FieldErrorf(config.MapKeyPath(at("model_map"), from), "maps to an empty model")
+			}
+		}
+	}
+
+	if err := validatePrices("prices", cfg.Prices); err != nil {
+		return err
+	}
+	return validateModelRouting(cfg)
+}
+
+// validTopPath reports whether path is a single segment like /openai
+func validTopPath(path string) bool {
+	top, ok := strings.CutPrefix(path, "/")
+	return ok && top != "" && !strings.ContainsAny(top, "/?#%\\ \t")
+}
+
+// validateURL accepts absolute http(s) urls with a host
+func validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid url '%s': %v", raw, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("'%s' must be an absolute http(s) url", raw)
+	}
+	return nil
+}
+
+func validateModelRouting(cfg *config.RoutesConfig) error {
+	mr := cfg.ModelRouting
+	if mr == nil {
+		return nil
+	}
+
+	switch {
+	case !validTopPath(mr.Path):
+		return config.FieldErrorf("model_routing.path", "'%s' must be a single segment like /v1", mr.Path)
+	case config.ReservedTopRoutes[strings.TrimPrefix(mr.Path, "/")]:
+		return config.FieldErrorf("model_routing.path", "'%s' is reserved by system", mr.Path)
+	case cfg.RouteByPath(mr.Path) != nil:
+		return config.FieldErrorf("model_routing.path", "'%s' is already used by a route", mr.Path)
+	case len(mr.Rules) == 0:
+		return config.FieldErrorf("model_routing.rules", "at least one rule is required")
+	case mr.MaxBodySize < 0:
+		return config.FieldErrorf("model_routing.max_body_size", "must not be negative")
+	}
+
+	for i, rule := range mr.Rules {
+		field := config.JoinPath("model_routing.rules", i)
+		if rule.Model == "" {
+			return config.FieldErrorf(config.JoinPath(field, "model"), "is empty")
+		}
+		if cfg.RouteByPath(rule.Route) == nil {
+			return config.FieldErrorf(config.JoinPath(field, "route"), "unknown route '%s'", rule.Route)
+		}
+	}
+	return nil
+}
+
+func validatePrices(field string, prices map[string]config.Price) error {
+	for _, model := range slices.Sorted(maps.Keys(prices)) {
+		p := prices[model]
+		if model == "" {
+			return config.FieldErrorf(field, "has an empty model name")
+		}
+		if p.Input < 0 || p.Output < 0 || p.CachedInput < 0 {
+			return config.FieldErrorf(config.MapKeyPath(field, model), "prices must be non-negative")
+		}
 	}
 	return nil
 }
@@ -0,0 +1,101 @@
+package watcher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/poixeai/proxify/infra/config"
+	"github.com/poixeai/proxify/infra/logger"
+	"github.com/poixeai/proxify/infra/metrics"
+	"github.com/poixeai/proxify/infra/store"
+)
+
+// ErrInvalidRoutes wraps validation failures of an update
+var ErrInvalidRoutes = errors.New("invalid routes config")
+
+var (
+	updateMu     sync.Mutex
+	configSource config.RoutesConfigSource // where the routes were loaded from
+)
+
+// Update applies fn to a copy of the current routes config, validates the
+// result and swaps it in. JSON config files are written back atomically
+// first, so memory and disk never disagree; env-based configs, config
+// directories, YAML/TOML files and files with ${VAR} references only change
+// in memory, rewriting them would drop comments, bake secrets into the file
+// or pick one of several files. It reports whether the change was persisted.
+func Update(fn func(cfg *config.RoutesConfig) error) (*config.RoutesConfig, bool, error) {
+	return update(SourceAdmin, fn)
+}
+
+func update(source string, fn func(cfg *config.RoutesConfig) error) (*config.RoutesConfig, bool, error) {
+	updateMu.Lock()
+	defer updateMu.Unlock()
+
+	cfg, err := clone(GetRoutes())
+	if err != nil {
+		return nil, false, err
+	}
+	if err := fn(cfg); err != nil {
+		return nil, false, err
+	}
+	if err := validateRoutes(cfg); err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrInvalidRoutes, err)
+	}
+
+	persisted := false
+	if writable() {
+		// admin values are literal, a ${ in them must survive the reload
+		out, err := clone(cfg)
+		if err != nil {
+			return nil, false, err
+		}
+		config.EscapeEnvRefs(out)
+		if err := store.WriteJSON(configSource.Path, out); err != nil {
+			return nil, false, fmt.Errorf("write %s: %w", configSource.Path, err)
+		}
+		persisted = true
+	}
+
+	apply(cfg, source)
+	metrics.ConfigReloads.Inc("success")
+	logger.Infof("[%s] routes updated by %s (%d routes)", configSource.Description(), source, len(cfg.Routes))
+	return cfg, persisted, nil
+}
+
+// writable reports whether updates can be written back to the config file
+func writable() bool {
+	if !configSource.SupportsWatch() {
+		return false
+	}
+	if isDir(configSource.Path) {
+		logger.Warnf("[%s] is a config directory, routes update kept in memory only", configSource.Description())
+		return false
+	}
+	data, err := os.ReadFile(configSource.Path)
+	if err != nil {
+		// not created yet, written as JSON unless named otherwise
+		return os.IsNotExist(err) && config.DetectFormat(configSource.Path, []byte("{")) == config.FormatJSON
+	}
+	if config.DetectFormat(configSource.Path, data) != config.FormatJSON || config.HasEnvRefs(data) {
+		logger.Warnf("[%s] is not plain JSON, routes update kept in memory only", configSource.Description())
+		return false
+	}
+	return true
+}
+
+// clone deep copies a config so updates never touch the one being served
+func clone(cfg *config.RoutesConfig) (*config.RoutesConfig, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var out config.RoutesConfig
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
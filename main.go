@@ -1,10 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/poixeai/proxify/infra/billing"
 	"github.com/poixeai/proxify/infra/config"
+	"github.com/poixeai/proxify/infra/health"
 	"github.com/poixeai/proxify/infra/logger"
+	"github.com/poixeai/proxify/infra/quota"
+	"github.com/poixeai/proxify/infra/tracing"
 	"github.com/poixeai/proxify/infra/watcher"
 	"github.com/poixeai/proxify/router"
 	"github.com/poixeai/proxify/util"
@@ -36,16 +48,51 @@ func main() {
 		logger.Infof("Token auth enabled, header=%s", authCfg.TokenHeader)
 	}
 
+	// API keys
+	if authCfg.Keys != nil {
+		if authCfg.TokenHeader == "" {
+			logger.Errorf("AUTH_TOKEN_HEADER is required when %s is set", config.APIKeysPathEnv)
+			return
+		}
+		logger.Infof("API keys enabled, header=%s, keys=%d", authCfg.TokenHeader, authCfg.Keys.Len())
+	}
+
 	if len(authCfg.IPNets) > 0 {
 		logger.Infof("IP whitelist enabled, rules=%d", len(authCfg.IPNets))
 	}
 
+	// init OTLP trace export
+	tracing.Init(tracing.ConfigFromEnv())
+
 	// init routes watcher
 	if err := watcher.InitRoutesWatcher(); err != nil {
 		logger.Errorf("Failed to load routes config: %v", err)
 		return
 	}
 
+	// init upstream health checker
+	health.Start(watcher.GetRoutes)
+
+	// load token quota counters
+	quotaPath := os.Getenv(quota.StorePathEnv)
+	if quotaPath == "" {
+		quotaPath = quota.DefaultStorePath
+	}
+	if err := quota.Open(quotaPath); err != nil {
+		logger.Errorf("Failed to load quota counters from %s: %v", quotaPath, err)
+		return
+	}
+
+	// load usage and spend ledger
+	usagePath := os.Getenv(billing.StorePathEnv)
+	if usagePath == "" {
+		usagePath = billing.DefaultStorePath
+	}
+	if err := billing.Open(usagePath); err != nil {
+		logger.Errorf("Failed to load usage ledger from %s: %v", usagePath, err)
+		return
+	}
+
 	// init gin
 	r := gin.New()
 	r.SetTrustedProxies(nil)
@@ -64,10 +111,42 @@ func main() {
 
 	// start server
 	port := util.GetEnvPort()
-	if err := r.Run(":" + port); err != nil {
-		logger.Errorf("Failed to start server: %v", err)
-		return
+	srv := &http.Server{Addr: ":" + port, Handler: r.Handler()}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		logger.Infof("Server running on port %s", port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("Failed to start server: %v", err)
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	shutdown(srv)
+}
+
+// how long in-flight requests, like long streams, may take to finish
+const shutdownTimeout = 30 * time.Second
+
+// shutdown stops taking requests, waits for the ones in flight and then
+// persists the counters they charged and exports their spans
+func shutdown(srv *http.Server) {
+	logger.Infof("Shutting down, waiting up to %v for in-flight requests", shutdownTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Errorf("Server shutdown: %v", err)
 	}
 
-	logger.Infof("Server running on port %s", port)
+	if err := quota.Flush(); err != nil {
+		logger.Errorf("[Quota] failed to persist counters: %v", err)
+	}
+	if err := billing.Flush(); err != nil {
+		logger.Errorf("[Billing] failed to persist usage: %v", err)
+	}
+	tracing.Flush()
 }
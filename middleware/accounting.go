@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/poixeai/proxify/infra/billing"
+	"github.com/poixeai/proxify/infra/ctx"
+	"github.com/poixeai/proxify/infra/usage"
+	"github.com/poixeai/proxify/infra/watcher"
+)
+
+// Accounting prices the usage reported by the upstream and adds it to the
+// spend ledger once the response is done
+func Accounting() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		route := ctx.GetRoute(c)
+		v, ok := c.Get(ctx.Usage)
+		if route == nil || !ok {
+			return
+		}
+		u, ok := v.(*usage.Usage)
+		if !ok {
+			return
+		}
+
+		e := billing.Entry{
+			Time:     time.Now(),
+			Identity: clientIdentity(c),
+			Owner:    c.GetString(ctx.APIKeyOwner),
+			Route:    route.Path,
+			Usage:    u,
+		}
+		if price, ok := billing.PriceFor(watcher.GetRoutes(), route, u.Model); ok {
+			e.Cost, e.Priced = billing.Cost(price, u), true
+			c.Set(ctx.Cost, e.Cost)
+		}
+
+		billing.Record(e)
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/poixeai/proxify/infra/config"
+	"github.com/poixeai/proxify/infra/ctx"
+	"github.com/poixeai/proxify/infra/response"
+)
+
+// AdminOnly guards management endpoints. When AUTH_ADMIN_TOKEN is set the
+// request must carry it in X-Admin-Token. Otherwise the shared gateway token
+// is required and consumers authenticated with a per-consumer api key are
+// rejected. Without any token configured the endpoints are closed.
+func AdminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var cfg *config.AuthConfig
+		if v, ok := c.Get("auth_config"); ok {
+			cfg, _ = v.(*config.AuthConfig)
+		}
+
+		switch {
+		case cfg == nil || (cfg.AdminToken == "" && cfg.TokenKey == ""):
+			response.RespondForbiddenError(c, "Forbidden: admin endpoints are disabled, set AUTH_ADMIN_TOKEN to enable them.")
+		case cfg.AdminToken != "" && !cfg.IsAdmin(c.GetHeader(config.AdminTokenHeader)):
+			response.RespondForbiddenError(c, "Forbidden: this endpoint requires the admin token in "+config.AdminTokenHeader+".")
+		case cfg.AdminToken == "" && c.GetString(ctx.APIKeyName) != "":
+			response.RespondForbiddenError(c, "Forbidden: this endpoint requires the gateway admin token.")
+		default:
+			c.Next()
+			return
+		}
+		c.Abort()
+	}
+}
@@ -1,11 +1,15 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"net"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/poixeai/proxify/infra/config"
+	"github.com/poixeai/proxify/infra/ctx"
+	"github.com/poixeai/proxify/infra/metrics"
 )
 
 func Auth() gin.HandlerFunc {
@@ -32,6 +36,7 @@ func Auth() gin.HandlerFunc {
 			}
 
 			if !allowed {
+				metrics.AuthRejections.Inc("ip_not_allowed")
 				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
 					"error": "IP not allowed",
 				})
@@ -40,14 +45,57 @@ func Auth() gin.HandlerFunc {
 		}
 
 		// ===== Token Auth =====
-		if cfg.TokenKey != "" {
+		if cfg.TokenAuthEnabled() {
+			// the admin token is accepted in place of the gateway token
+			if cfg.IsAdmin(c.GetHeader(config.AdminTokenHeader)) {
+				c.Next()
+				return
+			}
+
 			token := c.GetHeader(cfg.TokenHeader)
-			if token == "" || token != cfg.TokenKey {
+
+			// shared token
+			if cfg.TokenKey != "" && subtle.ConstantTimeCompare([]byte(token), []byte(cfg.TokenKey)) == 1 {
+				c.Next()
+				return
+			}
+
+			// per-consumer keys
+			key := cfg.Keys.Lookup(token)
+			if key == nil {
+				metrics.AuthRejections.Inc("invalid_token")
 				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 					"error": "Invalid token",
 				})
 				return
 			}
+
+			if !key.IsEnabled() {
+				metrics.AuthRejections.Inc("key_disabled")
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+					"error": "API key disabled",
+				})
+				return
+			}
+
+			if key.IsExpired(time.Now()) {
+				metrics.AuthRejections.Inc("key_expired")
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+					"error": "API key expired",
+				})
+				return
+			}
+
+			if c.GetBool(ctx.Proxified) && !key.AllowsRoute("/"+c.GetString(ctx.TopRoute)) {
+				metrics.AuthRejections.Inc("route_not_allowed")
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"error": "Route not allowed for this API key",
+				})
+				return
+			}
+
+			c.Set(ctx.APIKeyName, key.Name)
+			c.Set(ctx.APIKeyOwner, key.Owner)
 		}
 
 		c.Next()
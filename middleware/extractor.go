@@ -1,8 +1,18 @@
 package middleware
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
 	"github.com/gin-gonic/gin"
+	"github.com/poixeai/proxify/infra/balancer"
+	"github.com/poixeai/proxify/infra/config"
 	"github.com/poixeai/proxify/infra/ctx"
+	"github.com/poixeai/proxify/infra/health"
+	"github.com/poixeai/proxify/infra/logger"
+	"github.com/poixeai/proxify/infra/response"
 	"github.com/poixeai/proxify/infra/watcher"
 	"github.com/poixeai/proxify/util"
 )
@@ -13,6 +23,54 @@ func Extractor() gin.HandlerFunc {
 		top, sub := util.ExtractRoute(path)
 		query := c.Request.URL.RawQuery
 
+		// check if route exists in routes.json
+		cfg := watcher.GetRoutes()
+		r := cfg.RouteByPath("/" + top)
+
+		// unified path, the model in the body picks the route
+		mr := cfg.ModelRouting
+		unified := r == nil && mr != nil && mr.Path == "/"+top
+		modelList := unified && c.Request.Method == http.MethodGet && strings.TrimSuffix(sub, "/") == "/models"
+
+		if unified && !modelList {
+			// the body is read before auth, so it is capped
+			if c.Request.Body != nil {
+				c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, mr.BodyLimit())
+			}
+			body, err := util.PeekBody(c.Request)
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.Set(ctx.TopRoute, top)
+				msg := fmt.Sprintf("Request Entity Too Large: request body exceeds %d bytes.", tooLarge.Limit)
+				response.RespondError(c, http.StatusRequestEntityTooLarge, msg, response.INVALID_REQUEST_ERROR)
+				c.Abort()
+				return
+			}
+			if err != nil {
+				logger.Warnf("Extractor: failed to read request body: %v", err)
+			}
+			model := util.ModelOf(body)
+
+			r = cfg.RouteForModel(model)
+			if r == nil {
+				msg := "Bad Request: model routing needs a `model` field in the request body."
+				if model != "" {
+					msg = fmt.Sprintf("Bad Request: no route serves model [%s] under [%s].", model, mr.Path)
+				}
+				c.Set(ctx.TopRoute, top)
+				response.RespondError(c, http.StatusBadRequest, msg, response.INVALID_REQUEST_ERROR)
+				c.Abort()
+				return
+			}
+
+			// the request now belongs to the matched route
+			c.Set(ctx.RequestModel, model)
+			top = strings.TrimPrefix(r.Path, "/")
+			if !mr.StripPrefix {
+				sub = path
+			}
+		}
+
 		if query != "" {
 			if sub == "" {
 				sub = "?" + query
@@ -24,25 +82,27 @@ func Extractor() gin.HandlerFunc {
 		// store top and sub path into context for later use
 		c.Set(ctx.TopRoute, top)
 		c.Set(ctx.SubPath, sub)
+		c.Set(ctx.ModelList, modelList)
 
-		// check if route exists in routes.json
-		cfg := watcher.GetRoutes()
-		found := false
-		for i := range cfg.Routes {
-			r := &cfg.Routes[i]
-
-			if r.Path == "/"+top {
-				found = true
-				c.Set(ctx.TargetEndpoint, r.Target)
-
-				// store matched route config
-				c.Set(ctx.RouteConfig, r)
-
-				break
-			}
+		if r != nil {
+			// release the outstanding request once the chain is done
+			defer selectTarget(c, r).Done()
 		}
-		c.Set(ctx.Proxified, found)
+		c.Set(ctx.Proxified, r != nil)
 
 		c.Next()
 	}
 }
+
+// selectTarget picks one of the healthy route targets and stores the matched route
+func selectTarget(c *gin.Context, r *config.Route) *balancer.Selection {
+	sel := balancer.Pick(r, health.Available(r))
+	if sel != nil {
+		c.Set(ctx.TargetEndpoint, sel.Target.URL)
+		c.Set(ctx.Upstream, sel)
+	}
+
+	// store matched route config
+	c.Set(ctx.RouteConfig, r)
+	return sel
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/poixeai/proxify/infra/config"
+	"github.com/poixeai/proxify/infra/ctx"
+	"github.com/poixeai/proxify/infra/watcher"
+)
+
+func TestExtractorDispatchesByModel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Setenv(config.RoutesConfigPathEnv, "")
+	t.Setenv(config.RoutesConfigJSONEnv, `{
+		"routes": [
+			{"name": "OpenAI", "path": "/openai", "target": "https://api.openai.com"},
+			{"name": "Claude", "path": "/claude", "target": "https://api.anthropic.com"}
+		],
+		"model_routing": {
+			"path": "/v1",
+			"max_body_size": 64,
+			"rules": [{"model": "gpt-*", "route": "/openai"}, {"model": "claude-*", "route": "/claude"}]
+		}
+	}`)
+	if err := watcher.InitRoutesWatcher(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.Use(Extractor())
+	r.NoRoute(func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(ctx.TopRoute)+" "+c.GetString(ctx.SubPath))
+	})
+	do := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+		return w
+	}
+
+	if w := do(`{"model":"claude-sonnet-4"}`); w.Code != http.StatusOK || w.Body.String() != "claude /v1/chat/completions" {
+		t.Fatalf("expected dispatch to /claude, got %d %s", w.Code, w.Body)
+	}
+	if w := do(`{"messages":[]}`); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "`model`") {
+		t.Fatalf("expected 400 for a body without model, got %d %s", w.Code, w.Body)
+	}
+	if w := do(`{"model":"gpt-4o","input":"` + strings.Repeat("x", 64) + `"}`); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for a body over max_body_size, got %d %s", w.Code, w.Body)
+	}
+}
@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -8,6 +10,8 @@ import (
 	"github.com/poixeai/proxify/infra/config"
 	"github.com/poixeai/proxify/infra/ctx"
 	"github.com/poixeai/proxify/infra/logger"
+	"github.com/poixeai/proxify/infra/metrics"
+	"github.com/poixeai/proxify/infra/usage"
 	"github.com/poixeai/proxify/util"
 )
 
@@ -28,6 +32,10 @@ func GinRequestLogger() gin.HandlerFunc {
 
 		clientIP := c.ClientIP()
 		targetURL := c.GetString(ctx.TargetURL)
+		if targetURL == "" {
+			// request did not reach the proxy, report the chosen target only
+			targetURL = c.GetString(ctx.TargetEndpoint)
+		}
 
 		topRoute := c.GetString(ctx.TopRoute)
 		if config.ReservedTopRoutes[topRoute] {
@@ -44,9 +52,37 @@ func GinRequestLogger() gin.HandlerFunc {
 			return
 		}
 
+		keyName := c.GetString(ctx.APIKeyName)
+		if keyName == "" {
+			keyName = "-"
+		}
+
+		tokens := "-"
+		if v, ok := c.Get(ctx.Usage); ok {
+			if u, ok := v.(*usage.Usage); ok {
+				model := u.Model
+				if model == "" {
+					model = "-"
+				}
+				tokens = fmt.Sprintf(
+					"%s in=%d out=%d cached=%d total=%d",
+					model, u.PromptTokens, u.CompletionTokens, u.CachedTokens, u.TotalTokens,
+				)
+				if cost, ok := c.Get(ctx.Cost); ok {
+					tokens += fmt.Sprintf(" cost=$%.6f", cost)
+				}
+			}
+		}
+
+		routeLabel := "-"
+		if route := ctx.GetRoute(c); route != nil {
+			routeLabel = route.Path
+		}
+		metrics.Requests.Inc(routeLabel, strconv.Itoa(status), metrics.MethodLabel(method))
+
 		logger.Infof(
-			"%s | %d | %s | %s -> %s | %v | %s",
-			reqID, status, method, path, targetURL, latency, clientIP,
+			"%s | %d | %s | %s -> %s | %v | %s | %s | %s",
+			reqID, status, method, path, targetURL, latency, clientIP, keyName, tokens,
 		)
 	}
 }
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+	"github.com/poixeai/proxify/infra/config"
+	"github.com/poixeai/proxify/infra/ctx"
+)
+
+// clientIdentity names the caller for limits and accounting: the gateway api
+// key name, else a hash of the AUTH_TOKEN_HEADER value, else the client ip.
+// The token is only trusted when Auth has checked it, an unchecked header
+// would let clients pick a fresh identity on every request. Raw tokens never
+// end up in keys, logs or persisted state.
+func clientIdentity(c *gin.Context) string {
+	if name := c.GetString(ctx.APIKeyName); name != "" {
+		return "key:" + name
+	}
+
+	if v, ok := c.Get("auth_config"); ok {
+		if cfg, ok := v.(*config.AuthConfig); ok && cfg.TokenHeader != "" && cfg.TokenAuthEnabled() {
+			if token := c.GetHeader(cfg.TokenHeader); token != "" {
+				sum := sha256.Sum256([]byte(token))
+				return "token:" + hex.EncodeToString(sum[:8])
+			}
+		}
+	}
+
+	return "ip:" + c.ClientIP()
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/poixeai/proxify/infra/config"
+)
+
+func TestClientIdentityIgnoresUncheckedToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	identity := func(cfg *config.AuthConfig, token string) string {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/openai/v1/models", nil)
+		c.Request.RemoteAddr = "203.0.113.7:1234"
+		c.Request.Header.Set("X-API-Token", token)
+		c.Set("auth_config", cfg)
+		return clientIdentity(c)
+	}
+
+	// header configured but token auth off, the value is never checked
+	open := &config.AuthConfig{TokenHeader: "X-API-Token"}
+	if a, b := identity(open, "random-1"), identity(open, "random-2"); a != "ip:203.0.113.7" || b != a {
+		t.Fatalf("expected the client ip for unchecked tokens, got %q and %q", a, b)
+	}
+
+	checked := &config.AuthConfig{TokenHeader: "X-API-Token", TokenKey: "gateway-token"}
+	if got := identity(checked, "gateway-token"); !strings.HasPrefix(got, "token:") {
+		t.Fatalf("expected a token hash once auth checks the token, got %q", got)
+	}
+}
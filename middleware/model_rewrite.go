@@ -5,45 +5,71 @@ import (
 	"io"
 
 	"github.com/gin-gonic/gin"
+	"github.com/poixeai/proxify/infra/config"
 	"github.com/poixeai/proxify/infra/ctx"
 	"github.com/poixeai/proxify/infra/logger"
+	"github.com/poixeai/proxify/infra/modelpolicy"
+	"github.com/poixeai/proxify/infra/response"
 	"github.com/poixeai/proxify/util"
 )
 
-// ModelRewrite rewrites the `model` field in Chat Completions style requests
-// based on route-level modelMap configuration.
+// ModelRewrite enforces the route-level model_policy and rewrites the model
+// based on model_map and the policy rewrite rules. Models are read from the
+// `model` field of the body and from url paths like Gemini's
+// /models/{model}:generateContent and Azure's /deployments/{name}.
 func ModelRewrite() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// get current route config from context
 		route := ctx.GetRoute(c)
-		if route == nil || len(route.ModelMap) == 0 {
+		if route == nil || (len(route.ModelMap) == 0 && route.ModelPolicy == nil) {
 			c.Next()
 			return
 		}
+		policy := modelpolicy.For(route)
 
-		// no body, nothing to do
-		if c.Request.Body == nil {
-			c.Next()
-			return
+		// model in the url path
+		subPath := c.GetString(ctx.SubPath)
+		if model, start, end := modelpolicy.PathModel(subPath); model != "" {
+			if !policy.Allowed(model) {
+				rejectModel(c, route, model)
+				return
+			}
+			newModel := policy.Rewrite(model)
+			if newModel != model {
+				logger.Infof("ModelRewrite: route=%s path model rewritten", route.Name)
+				c.Set(ctx.SubPath, subPath[:start]+newModel+subPath[end:])
+			}
+			c.Set(ctx.RequestModel, newModel)
 		}
 
-		// read original body
-		bodyBytes, err := io.ReadAll(c.Request.Body)
+		// read original body, it is put back for the handlers after us
+		bodyBytes, err := util.PeekBody(c.Request)
 		if err != nil {
 			logger.Warnf("ModelRewrite: failed to read request body: %v", err)
 			c.Next()
 			return
 		}
 
+		// no model in the body, nothing to do
+		model := util.ModelOf(bodyBytes)
+		if model == "" {
+			c.Next()
+			return
+		}
+		if !policy.Allowed(model) {
+			rejectModel(c, route, model)
+			return
+		}
+
 		// attempt to rewrite model
+		newModel := policy.Rewrite(model)
+		c.Set(ctx.RequestModel, newModel)
 		newBody, rewritten, err := util.RewriteChatCompletionModel(
 			bodyBytes,
-			route.ModelMap,
+			map[string]string{model: newModel},
 		)
 		if err != nil {
 			logger.Warnf("ModelRewrite: rewrite failed: %v", err)
-			// restore original body
-			c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
 			c.Next()
 			return
 		}
@@ -53,13 +79,18 @@ func ModelRewrite() gin.HandlerFunc {
 				"ModelRewrite: route=%s model rewritten",
 				route.Name,
 			)
-			bodyBytes = newBody
-		}
 
-		// IMPORTANT: restore body for downstream handlers
-		c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
-		c.Request.ContentLength = int64(len(bodyBytes))
+			// IMPORTANT: replace body for downstream handlers
+			c.Request.Body = io.NopCloser(bytes.NewReader(newBody))
+			c.Request.ContentLength = int64(len(newBody))
+		}
 
 		c.Next()
 	}
 }
+
+func rejectModel(c *gin.Context, route *config.Route, model string) {
+	logger.Warnf("ModelRewrite: route=%s model %s rejected by policy", route.Name, model)
+	response.RespondModelNotAllowedError(c, route.Path, model)
+	c.Abort()
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/poixeai/proxify/infra/ctx"
+	"github.com/poixeai/proxify/infra/logger"
+	"github.com/poixeai/proxify/infra/quota"
+	"github.com/poixeai/proxify/infra/response"
+	"github.com/poixeai/proxify/infra/usage"
+)
+
+// Quota rejects clients whose token budget on the matched route is used up,
+// and charges the tokens reported by the upstream once the response is done
+func Quota() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := ctx.GetRoute(c)
+		if route == nil || route.Quota == nil {
+			c.Next()
+			return
+		}
+
+		identity := clientIdentity(c)
+		st, ok := quota.Check(route, identity, time.Now())
+		if !ok {
+			period := "monthly"
+			if st.ResetAt().Equal(st.DailyResetAt) {
+				period = "daily"
+			}
+			logger.Warnf("Quota: route=%s identity=%s %s budget exceeded", route.Path, identity, period)
+			response.RespondQuotaExceededError(c, period, st.ResetAt())
+			c.Abort()
+			return
+		}
+
+		c.Next()
+
+		if v, ok := c.Get(ctx.Usage); ok {
+			if u, ok := v.(*usage.Usage); ok {
+				quota.Add(route.Path, identity, int64(u.TotalTokens), time.Now())
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/poixeai/proxify/infra/config"
+	"github.com/poixeai/proxify/infra/ctx"
+	"github.com/poixeai/proxify/infra/logger"
+	"github.com/poixeai/proxify/infra/ratelimit"
+	"github.com/poixeai/proxify/infra/response"
+	"github.com/poixeai/proxify/infra/usage"
+)
+
+// RateLimit enforces the token bucket limits of the matched route. All limits
+// are checked before any is taken from, token limits are charged with the
+// usage of the response once it is done.
+func RateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := ctx.GetRoute(c)
+		if route == nil || len(route.RateLimits) == 0 {
+			c.Next()
+			return
+		}
+
+		reqs := make([]ratelimit.Request, len(route.RateLimits))
+		for i, rl := range route.RateLimits {
+			reqs[i] = rateLimitRequest(c, route, i, rl)
+		}
+
+		res, err := ratelimit.Take(c.Request.Context(), reqs...)
+		if err != nil {
+			// fail open, a broken limiter backend must not take the gateway down
+			logger.Errorf("RateLimit: backend error on route %s: %v", route.Path, err)
+		} else if !res.Allowed {
+			logger.Warnf("RateLimit: route=%s key=%s rejected, retry after %v", route.Path, reqs[res.Rejected].Key, res.RetryAfter)
+			response.RespondRateLimitError(c, res.RetryAfter)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+
+		v, ok := c.Get(ctx.Usage)
+		if !ok {
+			return
+		}
+		u, ok := v.(*usage.Usage)
+		if !ok || u.TotalTokens <= 0 {
+			return
+		}
+		for i, rl := range route.RateLimits {
+			if rl.Tokens <= 0 {
+				continue
+			}
+			r := reqs[i]
+			if err := ratelimit.Charge(c.Request.Context(), r.Key, r.Limit, float64(u.TotalTokens)); err != nil {
+				logger.Errorf("RateLimit: backend error for %s: %v", r.Key, err)
+			}
+		}
+	}
+}
+
+// rateLimitRequest builds the bucket request of one limit, request limits
+// cost one, token limits only need a non-empty bucket up front
+func rateLimitRequest(c *gin.Context, route *config.Route, index int, rl config.RateLimit) ratelimit.Request {
+	size, cost := rl.Requests, 1.0
+	if rl.Tokens > 0 {
+		size, cost = rl.Tokens, 0
+	}
+	burst := rl.Burst
+	if burst <= 0 {
+		burst = size
+	}
+	per := rl.Per.Or(time.Minute)
+
+	return ratelimit.Request{
+		Key: rateLimitKey(c, route, index, rl.Key),
+		Limit: ratelimit.Limit{
+			Rate:  float64(size) / per.Seconds(),
+			Burst: burst,
+		},
+		Cost: cost,
+	}
+}
+
+func rateLimitKey(c *gin.Context, route *config.Route, index int, kind string) string {
+	// the index keeps several limits of one route apart
+	prefix := "rl:" + route.Path + ":" + strconv.Itoa(index) + ":"
+
+	switch kind {
+	case config.RateLimitKeyRoute:
+		return prefix + "route"
+	case config.RateLimitKeyToken:
+		return prefix + clientIdentity(c)
+	default:
+		return prefix + "ip:" + c.ClientIP()
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/poixeai/proxify/infra/ctx"
+	"github.com/poixeai/proxify/infra/tracing"
+	"github.com/poixeai/proxify/infra/usage"
+)
+
+// Tracing starts a server span for every request, continuing the caller's
+// trace when it sent a W3C traceparent header
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !tracing.Enabled() {
+			c.Next()
+			return
+		}
+
+		parent := tracing.Extract(c.Request.Context(), c.Request.Header)
+		spanCtx, span := tracing.StartSpan(parent, c.Request.Method, tracing.KindServer)
+		defer span.End()
+		c.Request = c.Request.WithContext(spanCtx)
+
+		span.SetAttr("http.request.method", c.Request.Method)
+		span.SetAttr("url.path", c.Request.URL.Path)
+		span.SetAttr("client.address", c.ClientIP())
+		span.SetAttr("proxify.request_id", c.GetString(ctx.RequestID))
+
+		c.Next()
+
+		if route := ctx.GetRoute(c); route != nil {
+			span.SetName(c.Request.Method + " " + route.Path)
+			span.SetAttr("http.route", route.Path)
+		}
+		if name := c.GetString(ctx.APIKeyName); name != "" {
+			span.SetAttr("proxify.api_key", name)
+		}
+
+		status := c.Writer.Status()
+		span.SetAttr("http.response.status_code", status)
+		if status >= http.StatusInternalServerError {
+			span.SetError(http.StatusText(status))
+		}
+
+		if c.GetBool(ctx.Proxified) {
+			u, _ := c.Get(ctx.Usage)
+			up, _ := u.(*usage.Usage)
+			tracing.SetGenAI(span, c.GetString(ctx.RequestModel), up, c.GetBool(ctx.Streaming))
+		}
+	}
+}
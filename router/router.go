@@ -12,8 +12,12 @@ func SetRoutes(r *gin.Engine) {
 	r.Use(middleware.Recover())
 	r.Use(middleware.CORS())
 	r.Use(middleware.GinRequestLogger())
+	r.Use(middleware.Tracing())
 	r.Use(middleware.Extractor())
 	r.Use(middleware.Auth())
+	r.Use(middleware.RateLimit())
+	r.Use(middleware.Quota())
+	r.Use(middleware.Accounting())
 	r.Use(middleware.ModelRewrite())
 
 	// ==== routes.json ====
@@ -21,5 +25,27 @@ func SetRoutes(r *gin.Engine) {
 	{
 		apiGroup.GET("/", controller.ShowPathHandler)
 		apiGroup.GET("/routes", controller.RoutesHandler)
+		apiGroup.GET("/health/upstreams", controller.UpstreamHealthHandler)
+		apiGroup.GET("/metrics", controller.MetricsHandler)
+		apiGroup.GET("/models", controller.ModelsHandler)
+		apiGroup.GET("/quota", middleware.AdminOnly(), controller.QuotaHandler)
+		apiGroup.POST("/quota/reset", middleware.AdminOnly(), controller.QuotaResetHandler)
+		apiGroup.GET("/usage", middleware.AdminOnly(), controller.UsageHandler)
+	}
+
+	// ==== admin ====
+	adminGroup := r.Group("/api/admin", middleware.AdminOnly())
+	{
+		adminGroup.GET("/routes", controller.AdminListRoutesHandler)
+		adminGroup.POST("/routes", controller.AdminCreateRouteHandler)
+		adminGroup.PUT("/routes/order", controller.AdminReorderRoutesHandler)
+		adminGroup.GET("/routes/:name", controller.AdminGetRouteHandler)
+		adminGroup.PUT("/routes/:name", controller.AdminUpdateRouteHandler)
+		adminGroup.DELETE("/routes/:name", controller.AdminDeleteRouteHandler)
+		adminGroup.GET("/config/versions", controller.AdminConfigVersionsHandler)
+		adminGroup.GET("/config/versions/:id", controller.AdminConfigVersionHandler)
+		adminGroup.POST("/config/versions/:id/rollback", controller.AdminConfigRollbackHandler)
+		adminGroup.GET("/config/diff", controller.AdminConfigDiffHandler)
+		adminGroup.GET("/breakers", controller.BreakersHandler)
 	}
 }
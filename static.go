@@ -42,6 +42,12 @@ func MountFrontend(r *gin.Engine) {
 			return
 		}
 
+		// model catalog under the unified model routing path
+		if c.GetBool(ctx.ModelList) {
+			controller.ModelsHandler(c)
+			return
+		}
+
 		topRoute := c.GetString(ctx.TopRoute)
 		if config.ReservedTopRoutes[topRoute] {
 			logger.Warnf("404 Not Found: %s", topRoute)
@@ -0,0 +1,31 @@
+package util
+
+// MatchGlob reports whether s matches pattern, where `*` matches any run of
+// characters (including `/`) and `?` matches exactly one. Model names like
+// `gpt-4o*` or `meta-llama/*` are the typical use.
+func MatchGlob(pattern, s string) bool {
+	p, i := 0, 0
+	star, next := -1, 0
+
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, next = p, i
+			p++
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case star >= 0:
+			// let the last star swallow one more character
+			next++
+			p, i = star+1, next
+		default:
+			return false
+		}
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
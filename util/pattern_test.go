@@ -0,0 +1,26 @@
+package util
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"gpt-4o", "gpt-4o", true},
+		{"gpt-4o*", "gpt-4o-2024-08-06", true},
+		{"gpt-4o*", "gpt-4", false},
+		{"*sonnet*", "claude-sonnet-4-20250514", true},
+		{"meta-llama/*", "meta-llama/Llama-3-70b", true},
+		{"gpt-?o", "gpt-4o", true},
+		{"*", "", true},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+	}
+
+	for _, tc := range cases {
+		if got := MatchGlob(tc.pattern, tc.s); got != tc.want {
+			t.Errorf("MatchGlob(%q, %q) = %v, want %v", tc.pattern, tc.s, got, tc.want)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package util
 
-import "strings"
+import (
+	"net/url"
+	"strings"
+)
 
 // ExtractRoute splits "/openai/v1/chat" → "openai", "v1/chat"
 func ExtractRoute(path string) (string, string) {
@@ -19,3 +22,13 @@ func JoinURL(base, sub string) string {
 	sub = strings.TrimLeft(sub, "/")
 	return base + "/" + sub
 }
+
+// RedactURL keeps the scheme, host and path of a url, dropping user info and
+// query that may hold secrets
+func RedactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String()
+}